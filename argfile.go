@@ -0,0 +1,237 @@
+package exiftool
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrArgInvalid is the cause of an *ArgError for an argument that can't be
+// written to a Stayopen's argfile
+var ErrArgInvalid = errors.New("Invalid argument")
+
+// cstrPrefix marks an argfile line that exiftool decodes like a C string,
+// so it can hold line breaks
+const cstrPrefix = "#[CSTR]"
+
+// cstrEscaper escapes the characters EncodeArg can't write as they are.
+// exiftool decodes #[CSTR] lines as a Perl string in double quotes, which
+// has no escape for a vertical tab, and escapes $, @ and " itself first,
+// but they are escaped here too so they are never interpolated.
+var cstrEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`, "\t", `\t`,
+	"\f", `\f`, "\v", `\x0b`, "$", `\$`, "@", `\@`, `"`, `\"`)
+
+// EncodeArg returns arg as a line of the -@ argfile a Stayopen sends its
+// requests through, without the line break. exiftool reads each line as
+// one argument, skips blank lines and lines starting with # and strips
+// leading and trailing whitespace. In tag assignments it also removes the
+// whitespace before the = and a single space after it, so -Comment= x
+// would set Comment to x. Arguments that would be changed by any of that
+// are written in exiftool's #[CSTR] format, which is taken as it is apart
+// from escapes like \n and \x20. Arguments that contain a NUL byte can't be
+// written and return an *ArgError.
+func EncodeArg(arg string) (string, error) {
+	if strings.IndexByte(arg, 0) != -1 {
+		return "", &ArgError{Arg: arg, Reason: "contains a NUL byte", Err: ErrArgInvalid}
+	}
+
+	if arg != "" && arg[0] != '#' && strings.Trim(arg, argfileSpace) == arg && !strings.ContainsAny(arg, "\r\n") &&
+		trimAssignment(arg) == arg {
+		return arg, nil
+	}
+
+	// spaces only need escaping at the ends of the line
+	inner := strings.TrimLeft(arg, " ")
+	lead := len(arg) - len(inner)
+	inner = strings.TrimRight(inner, " ")
+	trail := len(arg) - lead - len(inner)
+	return cstrPrefix + strings.Repeat(`\x20`, lead) + cstrEscaper.Replace(inner) + strings.Repeat(`\x20`, trail), nil
+}
+
+// argfileSpace is the whitespace exiftool strips from argfile lines. It
+// reads them as bytes so other Unicode spaces are kept.
+const argfileSpace = " \t\n\r\f\v"
+
+// assignmentSpace is the pattern exiftool uses to remove the whitespace
+// around the =, +=, -= or <= of a tag assignment in a plain argfile line,
+// s/^(-[-:\w]+#?)\s*([-+<]?=) ?/$1$2/
+var assignmentSpace = regexp.MustCompile(`^(-[-:\w]+#?)[ \t\n\r\f\v]*([-+<]?=) ?`)
+
+// trimAssignment returns line as exiftool reads it if it is a plain line
+// that assigns a tag value, like -Comment = x
+func trimAssignment(line string) string {
+	return assignmentSpace.ReplaceAllString(line, "$1$2")
+}
+
+// DecodeArg reads a line of an argfile like exiftool does, so it is the
+// inverse of EncodeArg. It returns false for blank lines and comments.
+// Plain lines have the spaces around a tag assignment's = removed.
+// #[CSTR] lines are decoded like a Perl string in double quotes, with the
+// escapes \n, \r, \t, \f, \a, \b, \e, \NNN octal, \xNN, \x{NNNN}, \cX,
+// \N{U+NNNN} and the case modifiers \l, \u, \L, \U, \Q and \E. Any other
+// character after a backslash stands for itself.
+func DecodeArg(line string) (string, bool) {
+	line = strings.Trim(line, argfileSpace)
+	if strings.HasPrefix(line, cstrPrefix) {
+		return decodeCSTR(line[len(cstrPrefix):]), true
+	}
+	if line == "" || line[0] == '#' {
+		return "", false
+	}
+	return trimAssignment(line), true
+}
+
+// cstrWriter applies Perl's case modifiers to a decoded #[CSTR] line
+type cstrWriter struct {
+	strings.Builder
+
+	// next is 'l' or 'u' to change the case of the next character, and
+	// modes the \L, \U and \Q in effect, innermost last
+	next  byte
+	modes []byte
+}
+
+func (w *cstrWriter) writeRune(r rune) {
+	if r > 0xff {
+		w.WriteRune(r)
+		return
+	}
+
+	c := byte(r)
+	mode := w.next
+	w.next = 0
+	for i := len(w.modes) - 1; i >= 0 && mode == 0; i-- {
+		if w.modes[i] != 'Q' {
+			mode = lower(w.modes[i])
+		}
+	}
+	switch mode {
+	case 'l':
+		c = lower(c)
+	case 'u':
+		c = upper(c)
+	}
+
+	for _, m := range w.modes {
+		if m == 'Q' && !isWordByte(c) {
+			w.WriteByte('\\')
+			break
+		}
+	}
+	w.WriteByte(c)
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// cstrEscapes are the escapes that stand for a single character
+var cstrEscapes = map[byte]rune{'n': '\n', 'r': '\r', 't': '\t', 'f': '\f', 'a': '\a', 'b': '\b', 'e': 0x1b}
+
+func decodeCSTR(s string) string {
+	var w cstrWriter
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			w.writeRune(rune(s[i]))
+			continue
+		}
+
+		i++
+		c := s[i]
+		if r, ok := cstrEscapes[c]; ok {
+			w.writeRune(r)
+			continue
+		}
+		switch c {
+		case 'l', 'u':
+			w.next = c
+		case 'L', 'U', 'Q':
+			w.modes = append(w.modes, c)
+		case 'E':
+			if len(w.modes) > 0 {
+				w.modes = w.modes[:len(w.modes)-1]
+			}
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			n := digits(s[i:], 3, 8)
+			w.writeRune(parseRune(s[i:i+n], 8))
+			i += n - 1
+		case 'x':
+			if n, ok := braced(s[i+1:]); ok {
+				w.writeRune(parseRune(s[i+2:i+n], 16))
+				i += n
+				break
+			}
+			n := digits(s[i+1:], 2, 16)
+			w.writeRune(parseRune(s[i+1:i+1+n], 16))
+			i += n
+		case 'c':
+			if i+1 < len(s) {
+				i++
+				w.writeRune(rune(upper(s[i]) ^ 64))
+			}
+		case 'N':
+			if n, ok := braced(s[i+1:]); ok && strings.HasPrefix(s[i+2:], "U+") {
+				w.WriteRune(parseRune(s[i+4:i+n], 16))
+				i += n
+				break
+			}
+			w.writeRune('N')
+		default:
+			w.writeRune(rune(c))
+		}
+	}
+	return w.String()
+}
+
+// digits returns how many of the first max bytes of s are digits in base
+func digits(s string, max, base int) int {
+	n := 0
+	for n < len(s) && n < max && strings.IndexByte("0123456789abcdef"[:base], lower(s[n])) != -1 {
+		n++
+	}
+	return n
+}
+
+// braced returns the index of the } closing a { at the start of s
+func braced(s string) (int, bool) {
+	if !strings.HasPrefix(s, "{") {
+		return 0, false
+	}
+	n := strings.IndexByte(s, '}')
+	return n + 1, n != -1
+}
+
+// parseRune parses digits in base like Perl does, where no digits is zero
+func parseRune(s string, base int) rune {
+	r, _ := strconv.ParseInt(s, base, 32)
+	return rune(r)
+}
+
+func upper(c byte) byte {
+	if 'a' <= c && c <= 'z' {
+		return c - ('a' - 'A')
+	}
+	return c
+}
+
+func lower(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// encodeArgs encodes args with EncodeArg
+func encodeArgs(args []string) ([]string, error) {
+	lines := make([]string, len(args))
+	for i, a := range args {
+		line, err := EncodeArg(a)
+		if err != nil {
+			return nil, err
+		}
+		lines[i] = line
+	}
+	return lines, nil
+}
@@ -0,0 +1,41 @@
+//go:build go1.18
+// +build go1.18
+
+package exiftool
+
+import (
+	"strings"
+	"testing"
+)
+
+func FuzzEncodeArg(f *testing.F) {
+	for _, seed := range []string{
+		"-json", "a.jpg", "-Comment=line 1\nline 2", "#comment", `back\slash`,
+		"\r\n", " padded ", "#[CSTR]already", "tab\tin the middle", "\x00",
+		"\v\f", "$x @y",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, arg string) {
+		line, err := EncodeArg(arg)
+		if err != nil {
+			if _, ok := err.(*ArgError); !ok {
+				t.Fatalf("%q: error is %T, not *ArgError", arg, err)
+			}
+			return
+		}
+
+		if strings.ContainsAny(line, "\r\n") {
+			t.Fatalf("%q: encoded as %q which has a line break", arg, line)
+		}
+
+		decoded, ok := DecodeArg(line)
+		if !ok {
+			t.Fatalf("%q: encoded as %q which exiftool would skip", arg, line)
+		}
+		if decoded != arg {
+			t.Fatalf("%q: encoded as %q which decodes to %q", arg, line, decoded)
+		}
+	})
+}
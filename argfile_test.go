@@ -0,0 +1,137 @@
+package exiftool
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeArg(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := map[string]string{
+		"-json":                      "-json",
+		"-Comment=tab\there":         "-Comment=tab\there",
+		`-Comment=back\slash`:        `-Comment=back\slash`,
+		"-Comment=line 1\nline 2":    `#[CSTR]-Comment=line 1\nline 2`,
+		"-Comment=a\\nb\r\n":         `#[CSTR]-Comment=a\\nb\r\n`,
+		"#not a comment.jpg":         "#[CSTR]#not a comment.jpg",
+		"-Comment=café ünïcode ✓":    "-Comment=café ünïcode ✓",
+		"-Comment=<b>\"quotes\"</b>": "-Comment=<b>\"quotes\"</b>",
+		"\tindented":                 `#[CSTR]\tindented`,
+		"":                           "#[CSTR]",
+		" a.jpg":                     `#[CSTR]\x20a.jpg`,
+		"a.jpg  ":                    `#[CSTR]a.jpg\x20\x20`,
+		" ":                          `#[CSTR]\x20`,
+		"-Comment=x\f":               `#[CSTR]-Comment=x\f`,
+		"\v":                         `#[CSTR]\x0b`,
+		"# $HOME @list \"x\"":        `#[CSTR]# \$HOME \@list \"x\"`,
+		"-Comment= x":                `#[CSTR]-Comment= x`,
+		"-Comment =x":                `#[CSTR]-Comment =x`,
+		"-XMP-dc:Subject\t+= a":      `#[CSTR]-XMP-dc:Subject\t+= a`,
+		"-Comment=x = y":             "-Comment=x = y",
+		"-Comment#=1":                "-Comment#=1",
+		"a.jpg = b":                  "a.jpg = b",
+	}
+	for in, want := range tests {
+		got, err := EncodeArg(in)
+		if assert.NoError(err, in) {
+			assert.Equal(want, got, in)
+			decoded, ok := DecodeArg(got)
+			assert.True(ok, in)
+			assert.Equal(in, decoded, in)
+		}
+	}
+
+	_, err := EncodeArg("a\x00b")
+	if assert.IsType(&ArgError{}, err) {
+		assert.Equal(ErrArgInvalid, errors.Cause(err))
+	}
+}
+
+func TestDecodeArg(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := map[string]string{
+		"  -json \t":                           "-json",
+		" #[CSTR]a\\nb\\\\ ":                   "a\nb\\",
+		`#[CSTR]\x41\x4a\x{263a}\x\101\0`:      "AJ\u263a\x00A\x00",
+		`#[CSTR]\cA\e\a\b\N{U+e9}`:             "\x01\x1b\x07\x08é",
+		`#[CSTR]\Uup\E \LDOWN\E \uword \lWORD`: "UP down Word wORD",
+		`#[CSTR]\Qa.b\E.\U\Qc.d`:               `a\.b.C\.D`,
+		`#[CSTR]$HOME @list "x" \q\$ end\`:     `$HOME @list "x" q$ end\`,
+		"#[CSTR]":                              "",
+		"-Comment = x":                         "-Comment=x",
+		"-Comment=  x ":                        "-Comment= x",
+		"-XMP:Subject#\t-= a":                  "-XMP:Subject#-=a",
+		"-Comment<= a.txt":                     "-Comment<=a.txt",
+		"#[CSTR]-Comment = x":                  "-Comment = x",
+	}
+	for in, want := range tests {
+		got, ok := DecodeArg(in)
+		assert.True(ok, in)
+		assert.Equal(want, got, in)
+	}
+
+	for _, in := range []string{"", " \t ", "# comment", "#CSTR a"} {
+		_, ok := DecodeArg(in)
+		assert.False(ok, in)
+	}
+}
+
+func TestStayOpenWriteMultiline(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "go-exiftool")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	data, err := ioutil.ReadFile("testdata/IMG_7238.JPG")
+	if !assert.NoError(err) {
+		return
+	}
+	name := filepath.Join(dir, "IMG_7238.JPG")
+	if !assert.NoError(ioutil.WriteFile(name, data, 0644)) {
+		return
+	}
+
+	stayopen, err := NewStayOpen("exiftool")
+	if !assert.NoError(err) {
+		return
+	}
+	defer stayopen.Stop()
+
+	ctx := context.Background()
+	comment := "line 1\nline 2 with \\n and \"quotes\""
+	_, err = stayopen.WriteTags(ctx, TagChanges{Set: map[string]string{"Comment": comment, "Artist": "#1 fan"}}, name)
+	if !assert.NoError(err) {
+		return
+	}
+
+	m, err := stayopen.ExtractMetadata(ctx, name, "-Comment", "-Artist")
+	if assert.NoError(err) {
+		c, _ := m.GetString("Comment")
+		assert.Equal(comment, c)
+		a, _ := m.GetString("Artist")
+		assert.Equal("#1 fan", a)
+	}
+
+	for _, comment := range []string{" padded ", " leading"} {
+		_, err = stayopen.WriteTags(ctx, TagChanges{Set: map[string]string{"Comment": comment}}, name)
+		if !assert.NoError(err) {
+			return
+		}
+		m, err = stayopen.ExtractMetadata(ctx, name, "-Comment")
+		if assert.NoError(err) {
+			c, _ := m.GetString("Comment")
+			assert.Equal(comment, c)
+		}
+	}
+}
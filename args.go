@@ -0,0 +1,252 @@
+package exiftool
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// ErrUnsafeFlag is the cause of an *ArgError for a flag that could modify
+// files or change how exiftool reads its arguments, or that isn't a known
+// read-only option or a tag name
+var ErrUnsafeFlag = errors.New("Unsafe flag")
+
+// ArgError explains why a filename or flag was rejected. Its cause is
+// ErrFilenameInvalid, ErrUnsafeFlag or ErrArgInvalid.
+type ArgError struct {
+	Arg    string
+	Reason string
+	Err    error
+}
+
+func (e *ArgError) Error() string {
+	return fmt.Sprintf("%s %q: %s", e.Err, e.Arg, e.Reason)
+}
+
+// Cause supports github.com/pkg/errors.Cause
+func (e *ArgError) Cause() error {
+	return e.Err
+}
+
+// SafePath returns filename in a form exiftool won't mistake for an
+// option. Names starting with a dash are prefixed with ./ so a file called
+// -delete_original is read rather than obeyed, as are names starting with
+// whitespace, which exiftool would strip from a Stayopen request. Names
+// that can't be passed to exiftool at all return an *ArgError.
+func SafePath(filename string) (string, error) {
+	reason := ""
+	switch {
+	case filename == "":
+		reason = "is empty"
+	case strings.IndexByte(filename, 0) != -1:
+		reason = "contains a NUL byte"
+	case strings.ContainsAny(filename, "\r\n"):
+		reason = "contains a line break"
+	}
+	if reason != "" {
+		return "", &ArgError{Arg: filename, Reason: reason, Err: ErrFilenameInvalid}
+	}
+
+	if strings.HasPrefix(filename, "-") || strings.TrimLeft(filename, " \t") != filename {
+		return "./" + filename, nil
+	}
+	return filename, nil
+}
+
+// fileArgs makes filenames safe and adds -charset filename=, which exiftool
+// needs to open names that aren't ASCII on Windows and to print names that
+// aren't UTF-8 as valid JSON. Names that aren't UTF-8 are taken to be
+// Latin-1. All of the names in a request have to use the same charset.
+func fileArgs(filenames ...string) ([]string, error) {
+	args := make([]string, 0, len(filenames)+2)
+	charset := ""
+	for _, f := range filenames {
+		safe, err := SafePath(f)
+		if err != nil {
+			return nil, err
+		}
+
+		if c := filenameCharset(f); c != "" {
+			if charset != "" && c != charset {
+				return nil, &ArgError{Arg: f, Reason: "mixes UTF-8 and Latin-1 filenames", Err: ErrFilenameInvalid}
+			}
+			charset = c
+		}
+		args = append(args, safe)
+	}
+
+	if charset != "" {
+		args = append([]string{"-charset", "filename=" + charset}, args...)
+	}
+	return args, nil
+}
+
+// filenameCharset returns the exiftool charset of filename, or an empty
+// string for ASCII names which don't need one
+func filenameCharset(filename string) string {
+	for i := 0; i < len(filename); i++ {
+		if filename[i] >= utf8.RuneSelf {
+			if utf8.ValidString(filename) {
+				return "utf8"
+			}
+			return "latin"
+		}
+	}
+	return ""
+}
+
+// sourceName is how exiftool prints filename in SourceFile after it was
+// passed with its filenameCharset
+func sourceName(filename string) string {
+	if filenameCharset(filename) != "latin" {
+		return filename
+	}
+
+	runes := make([]rune, len(filename))
+	for i := 0; i < len(filename); i++ {
+		runes[i] = rune(filename[i])
+	}
+	return string(runes)
+}
+
+// exiftoolOptions are all of exiftool's options by optionName, with true
+// for those that only change what is read or how it is printed. The others
+// write, rename or delete files, run Perl code, read more arguments or
+// interfere with Stayopen's requests. -p runs the Perl in advanced
+// formatting like ${Make;s/ //g}, and -api is only safe without the Filter
+// and FilterW options, which CheckFlags looks for.
+var exiftoolOptions = map[string]bool{
+	"a": true, "b": true, "c": true, "D": true, "d": true, "E": true,
+	"e": true, "F": true, "f": true, "G": true, "g": true, "H": true,
+	"h": true, "i": true, "j": true, "L": true, "l": true, "m": true,
+	"n": true, "q": true, "r": true, "S": true, "s": true, "T": true,
+	"t": true, "U": true, "u": true, "v": true, "X": true, "x": true,
+	"z": true, "api": true, "args": true, "argformat": true, "binary": true,
+	"charset": true, "composite": true, "coordformat": true, "csv": true,
+	"csvdelim": true, "dateformat": true, "decimal": true, "diff": true,
+	"duplicates": true, "ec": true, "ee": true, "escapec": true,
+	"escapehtml": true, "escapexml": true, "ex": true, "exclude": true,
+	"ext": true, "extension": true, "extractembedded": true, "fast": true,
+	"file": true, "fileorder": true, "fixbase": true, "forceprint": true,
+	"globaltimeshift": true, "groupheadings": true, "groupnames": true,
+	"hex": true, "htmldump": true, "htmlformat": true, "ignore": true,
+	"ignoreminorerrors": true, "json": true, "lang": true, "latin": true,
+	"listitem": true, "long": true, "password": true, "php": true,
+	"plot": true, "printconv": true, "quiet": true, "recurse": true,
+	"scanforxmp": true, "sep": true, "separator": true, "short": true,
+	"sort": true, "struct": true, "tab": true, "table": true, "unknown": true,
+	"ver": true, "verbose": true, "veryshort": true, "xmlformat": true,
+	"zip": true,
+
+	"@": false, "common_args": false, "config": false,
+	"delete_original": false, "echo": false, "efile": false, "execute": false,
+	"geosync": false, "geotag": false, "geotime": false, "if": false,
+	"k": false, "list": false, "list_dir": false, "listd": false,
+	"listf": false, "listg": false, "listgeo": false, "listr": false,
+	"listw": false, "listwf": false, "listx": false, "o": false, "out": false,
+	"overwrite_original": false, "overwrite_original_in_place": false,
+	"P": false, "p": false, "pause": false, "preserve": false,
+	"progress": false, "printformat": false, "restore_original": false,
+	"srcfile": false, "stay_open": false, "tagout": false, "tagoutext": false,
+	"tagsfromfile": false, "textout": false, "use": false, "userparam": false,
+	"W": false, "w": false, "wext": false, "wm": false, "writemode": false,
+}
+
+// optionName returns the name flag is looked up by in exiftoolOptions.
+// exiftool compares options without regard to case, except for the single
+// letter ones, and many take a number or a +, ! or . suffix, such as
+// -if2, -efile3!, -w+ and -G0:1.
+func optionName(flag string) string {
+	name := strings.TrimRight(strings.TrimPrefix(flag, "-"), "0123456789:.+!^")
+	if len(name) > 1 {
+		name = strings.ToLower(name)
+	}
+	return name
+}
+
+// isTagName returns true if flag names or excludes tags, like -EXIF:Make,
+// --XMP-dc:all or -*Date#
+func isTagName(flag string) bool {
+	name := strings.TrimPrefix(strings.TrimPrefix(flag, "-"), "-")
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("_*?:#-", r) {
+			return false
+		}
+	}
+	return name[0] != '-'
+}
+
+// CheckFlags returns an *ArgError for the first flag that isn't a read-only
+// exiftool option or tag name. That includes options that could modify
+// files, run Perl code or change how exiftool reads its arguments, and tag
+// assignments like -Artist=x. Flags in allow, like -overwrite_original, are
+// accepted anyway. Arguments that don't start with a dash are taken to be
+// the values of options and aren't checked.
+func CheckFlags(flags []string, allow ...string) error {
+	for i, f := range flags {
+		if !strings.HasPrefix(f, "-") || contains(allow, f) {
+			continue
+		}
+
+		reason := ""
+		if safe, ok := exiftoolOptions[optionName(f)]; ok && !strings.HasPrefix(f, "--") {
+			if !safe {
+				reason = "can modify files, run Perl code or change how arguments are read"
+			} else if optionName(f) == "api" && i+1 < len(flags) && isFilterOption(flags[i+1]) {
+				return &ArgError{Arg: flags[i+1], Reason: "runs Perl code on every value", Err: ErrUnsafeFlag}
+			}
+		} else if strings.IndexAny(f, "=<>") > 0 {
+			// also -csv=file and -json=file, which import tags from a file
+			reason = "assigns tag values"
+		} else if !isTagName(f) {
+			reason = "is not a read-only option or tag name"
+		}
+		if reason != "" {
+			return &ArgError{Arg: f, Reason: reason, Err: ErrUnsafeFlag}
+		}
+	}
+	return nil
+}
+
+// isFilterOption returns true if the value of -api, OPT[[^]=[VAL]], sets
+// the Filter or FilterW option, which are Perl expressions
+func isFilterOption(value string) bool {
+	name := value
+	if i := strings.IndexByte(name, '='); i != -1 {
+		name = name[:i]
+	}
+	name = strings.TrimSpace(strings.TrimSuffix(name, "^"))
+	return strings.EqualFold(name, "Filter") || strings.EqualFold(name, "FilterW")
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// readArgs checks the flags for a read-only request and returns them
+// followed by the safe forms of filenames
+func readArgs(flags []string, allow []string, filenames ...string) ([]string, error) {
+	if err := CheckFlags(flags, allow...); err != nil {
+		return nil, err
+	}
+
+	files, err := fileArgs(filenames...)
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, 0, len(flags)+len(files))
+	args = append(args, flags...)
+	return append(args, files...), nil
+}
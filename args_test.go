@@ -0,0 +1,135 @@
+package exiftool
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSafePath(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := map[string]string{
+		"a.jpg":             "a.jpg",
+		"/tmp/-o.jpg":       "/tmp/-o.jpg",
+		"-delete_original":  "./-delete_original",
+		"-":                 "./-",
+		"with `backquotes`": "with `backquotes`",
+		"caf\xe9.jpg":       "caf\xe9.jpg",
+	}
+	for in, want := range tests {
+		got, err := SafePath(in)
+		if assert.NoError(err, in) {
+			assert.Equal(want, got, in)
+		}
+	}
+
+	for _, in := range []string{"", "a\nb.jpg", "a\rb.jpg", "a\x00b.jpg"} {
+		_, err := SafePath(in)
+		if assert.IsType(&ArgError{}, err, in) {
+			assert.Equal(ErrFilenameInvalid, errors.Cause(err))
+		}
+	}
+}
+
+func TestFileArgs(t *testing.T) {
+	assert := assert.New(t)
+
+	args, err := fileArgs("a.jpg", "-b.jpg")
+	if assert.NoError(err) {
+		assert.Equal([]string{"a.jpg", "./-b.jpg"}, args)
+	}
+
+	args, err = fileArgs("a.jpg", "café.jpg")
+	if assert.NoError(err) {
+		assert.Equal([]string{"-charset", "filename=utf8", "a.jpg", "café.jpg"}, args)
+	}
+
+	args, err = fileArgs("caf\xe9.jpg")
+	if assert.NoError(err) {
+		assert.Equal([]string{"-charset", "filename=latin", "caf\xe9.jpg"}, args)
+	}
+	assert.Equal("café.jpg", sourceName("caf\xe9.jpg"))
+
+	_, err = fileArgs("café.jpg", "caf\xe9.jpg")
+	assert.IsType(&ArgError{}, err)
+}
+
+func TestCheckFlags(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(CheckFlags([]string{"-json", "-G0:1", "-d", "%Y-%m-%d", "-api", "LargeFileSupport=1", "-ThumbnailImage"}))
+	assert.NoError(CheckFlags([]string{"-s3", "-ee2", "-fast2", "-r.", "--printConv", "-EXIF:*", "--XMP-dc:all", "-ID3v2_3:all", "-File:FileName", "-*Date#"}))
+
+	unsafe := []string{
+		"-o", "-delete_original!", "-Overwrite_Original", "-tagsFromFile", "-@",
+		"-execute42", "-if", "-W", "-csv=tags.csv", "-Artist=someone", "-all=",
+		"-Comment<Filename", "-XMP:all>IPTC:all", "-textOut", "-TextOut!", "-tagOut",
+		"-tagOut+", "-tagOutExt", "-efile", "-efile3!", "-EFILE!", "-if2", "-IF",
+		"-echo3", "-use", "-k", "-listg1", "-j+=tags.json", "-", "--", "-%Y",
+		"-p", "-printFormat",
+	}
+	for _, f := range unsafe {
+		err := CheckFlags([]string{"-json", f})
+		if assert.IsType(&ArgError{}, err, f) {
+			assert.Equal(ErrUnsafeFlag, errors.Cause(err), f)
+			assert.Equal(f, err.(*ArgError).Arg)
+		}
+	}
+
+	// -api is safe unless it sets a filter, which is a Perl expression
+	for _, v := range []string{"Filter=s/a/b/", "filterw=1", "Filter^=", "FILTER"} {
+		err := CheckFlags([]string{"-json", "-API", v})
+		if assert.IsType(&ArgError{}, err, v) {
+			assert.Equal(ErrUnsafeFlag, errors.Cause(err), v)
+			assert.Equal(v, err.(*ArgError).Arg)
+		}
+	}
+	assert.NoError(CheckFlags([]string{"-api", "FilterX=1", "-api", "Compact"}))
+
+	assert.NoError(CheckFlags([]string{"-p", "${Make;s/ //g}"}, "-p"))
+	assert.NoError(CheckFlags([]string{"-overwrite_original"}, "-overwrite_original"))
+}
+
+func TestStayOpenDashFilename(t *testing.T) {
+	assert := assert.New(t)
+
+	// only a relative name can start with a dash
+	data, err := ioutil.ReadFile("testdata/IMG_7238.JPG")
+	if !assert.NoError(err) {
+		return
+	}
+	name := "-delete_original.jpg"
+	if !assert.NoError(ioutil.WriteFile(name, data, 0644)) {
+		return
+	}
+	defer os.Remove(name)
+
+	stayopen, err := NewStayOpen("exiftool")
+	if !assert.NoError(err) {
+		return
+	}
+	defer stayopen.Stop()
+
+	m, err := stayopen.ExtractMetadata(context.Background(), name)
+	if assert.NoError(err) {
+		fn, _ := m.GetString("FileName")
+		assert.Equal(name, fn)
+	}
+
+	results, err := stayopen.ExtractBatch([]string{name, "testdata/IMG_7238.JPG"})
+	if assert.NoError(err) {
+		assert.NoError(results[0].Err)
+		assert.NoError(results[1].Err)
+	}
+
+	_, err = stayopen.ExtractFlags(name, "-o", "copy.jpg")
+	assert.Equal(ErrUnsafeFlag, errors.Cause(err))
+
+	_, err = ExtractMetadata(context.Background(), "exiftool", name)
+	assert.NoError(err)
+}
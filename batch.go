@@ -0,0 +1,205 @@
+package exiftool
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// BatchResult is the outcome of extracting one of the files in a batch
+type BatchResult struct {
+	Filename string
+
+	// Metadata is nil when Err is set
+	Metadata *Metadata
+
+	// Err is the *Error exiftool reported for the file
+	Err error
+}
+
+// ExtractBatch extracts the metadata of many files with a single request,
+// which saves a round trip to exiftool per file. The results are in the same
+// order as filenames and there is one for every file, including those that
+// failed. MaxResponseSize applies to the batch as a whole.
+func (e *Stayopen) ExtractBatch(filenames []string, flags ...string) ([]BatchResult, error) {
+	return e.ExtractBatchContext(context.Background(), filenames, flags...)
+}
+
+// ExtractBatchContext is like ExtractBatch but gives up waiting for exiftool
+// when ctx is done
+func (e *Stayopen) ExtractBatchContext(ctx context.Context, filenames []string, flags ...string) ([]BatchResult, error) {
+	if len(filenames) == 0 {
+		return nil, nil
+	}
+
+	args, err := readArgs(append(flags[:len(flags):len(flags)], "-json"), e.AllowFlags, filenames...)
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, stderr, err := e.do(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	return parseBatch(stdout, stderr, filenames)
+}
+
+// ExtractBatch extracts the metadata of many files. Large batches are split
+// across the pool's Stayopen instances, which process their share at the
+// same time. See Stayopen.ExtractBatch.
+func (p *Pool) ExtractBatch(filenames []string, flags ...string) ([]BatchResult, error) {
+	return p.ExtractBatchContext(context.Background(), filenames, flags...)
+}
+
+// ExtractBatchContext is like ExtractBatch but returns ctx.Err() if ctx is
+// done before all of the results are returned
+func (p *Pool) ExtractBatchContext(ctx context.Context, filenames []string, flags ...string) ([]BatchResult, error) {
+	// splitting by the maximum size lets a large batch grow the pool
+	p.Lock()
+	parts := p.maxSize()
+	p.Unlock()
+
+	if len(filenames) < parts {
+		parts = len(filenames)
+	}
+	if parts <= 1 {
+		s, done, err := p.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer done()
+		return s.ExtractBatchContext(ctx, filenames, flags...)
+	}
+
+	size := (len(filenames) + parts - 1) / parts
+	results := make([]BatchResult, len(filenames))
+	errs := make([]error, parts)
+
+	// each part is a separate request so the parts are scheduled like any
+	// other request
+	var wg sync.WaitGroup
+	for i := 0; i < parts; i++ {
+		start := i * size
+		end := start + size
+		if end > len(filenames) {
+			end = len(filenames)
+		}
+		if start >= end {
+			break
+		}
+
+		wg.Add(1)
+		go func(i, start, end int) {
+			defer wg.Done()
+
+			s, done, err := p.acquire(ctx)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer done()
+
+			r, err := s.ExtractBatchContext(ctx, filenames[start:end], flags...)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			copy(results[start:end], r)
+		}(i, start, end)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// parseBatch splits the -json array exiftool printed for a batch into a
+// result per file, matched by SourceFile, and attaches the errors and
+// warnings on stderr to the files they are about. Warnings not about a
+// particular file are added to every file's Metadata.
+func parseBatch(stdout, stderr []byte, filenames []string) ([]BatchResult, error) {
+	results := make([]BatchResult, len(filenames))
+	for i, f := range filenames {
+		results[i].Filename = f
+	}
+
+	var general []Warning
+	var generalErr error
+	fileWarnings := make([][]Warning, len(filenames))
+
+	scanner := bufio.NewScanner(bytes.NewReader(stderr))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		warnings, err := parseStderr([]byte(line))
+
+		i := messageFile(filenames, line)
+		switch {
+		case i != -1 && err != nil:
+			if results[i].Err == nil {
+				results[i].Err = err
+			}
+		case i != -1:
+			fileWarnings[i] = append(fileWarnings[i], warnings...)
+		case err != nil:
+			if generalErr == nil {
+				generalErr = err
+			}
+		default:
+			general = append(general, warnings...)
+		}
+	}
+
+	if len(bytes.TrimSpace(stdout)) > 0 {
+		list, err := ParseMetadata(stdout)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range list {
+			source, _ := m.GetString("SourceFile")
+			if i := batchIndex(results, source); i != -1 {
+				results[i].Metadata = m
+			}
+		}
+	}
+
+	for i := range results {
+		r := &results[i]
+		switch {
+		case r.Err != nil:
+			r.Metadata = nil
+		case r.Metadata == nil && generalErr != nil:
+			r.Err = generalErr
+		case r.Metadata == nil:
+			r.Err = errors.New("No output")
+		default:
+			r.Metadata.Warnings = append(fileWarnings[i], general...)
+		}
+	}
+
+	return results, nil
+}
+
+// batchIndex finds the first result without metadata for source. exiftool
+// prints SourceFile with forward slashes on every platform, and as it was
+// passed by fileArgs.
+func batchIndex(results []BatchResult, source string) int {
+	for i, r := range results {
+		if r.Metadata != nil {
+			continue
+		}
+		name := filepath.ToSlash(sourceName(r.Filename))
+		if r.Filename == source || name == source || "./"+name == source {
+			return i
+		}
+	}
+	return -1
+}
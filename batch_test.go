@@ -0,0 +1,116 @@
+package exiftool
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBatch(t *testing.T) {
+	assert := assert.New(t)
+
+	stdout := []byte(`[{"SourceFile": "b.jpg", "Make": "Canon"}, {"SourceFile": "a.jpg", "Make": "Apple"}]`)
+	stderr := []byte("Error: File not found - c.jpg\nWarning: Something general\n")
+
+	results, err := parseBatch(stdout, stderr, []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg"})
+	if !assert.NoError(err) || !assert.Len(results, 4) {
+		return
+	}
+
+	assert.Equal("a.jpg", results[0].Filename)
+	if assert.NoError(results[0].Err) {
+		mk, _ := results[0].Metadata.GetString("Make")
+		assert.Equal("Apple", mk)
+		assert.Equal([]Warning{{Message: "Something general"}}, results[0].Metadata.Warnings)
+	}
+
+	if assert.NoError(results[1].Err) {
+		mk, _ := results[1].Metadata.GetString("Make")
+		assert.Equal("Canon", mk)
+	}
+
+	assert.Equal(ErrFileNotFound, errors.Cause(results[2].Err))
+	assert.Nil(results[2].Metadata)
+
+	assert.Error(results[3].Err)
+	assert.Nil(results[3].Metadata)
+}
+
+func TestStayOpenExtractBatch(t *testing.T) {
+	assert := assert.New(t)
+
+	stayopen, err := NewStayOpen("exiftool")
+	if !assert.NoError(err) {
+		return
+	}
+	defer stayopen.Stop()
+
+	files := []string{"testdata/IMG_7238.JPG", "testdata/missing.jpg", "testdata/IMG_7238-geo.jpg"}
+	results, err := stayopen.ExtractBatch(files, "-ShutterSpeed")
+	if !assert.NoError(err) || !assert.Len(results, 3) {
+		return
+	}
+
+	for i, r := range results {
+		assert.Equal(files[i], r.Filename)
+	}
+
+	if assert.NoError(results[0].Err) {
+		ss, _ := results[0].Metadata.GetString("ShutterSpeed")
+		assert.Equal("1/123", ss)
+	}
+	assert.Equal(ErrFileNotFound, errors.Cause(results[1].Err))
+	assert.NoError(results[2].Err)
+}
+
+func TestPoolExtractBatch(t *testing.T) {
+	assert := assert.New(t)
+
+	pool, err := NewPool("exiftool", 3)
+	if !assert.NoError(err) {
+		return
+	}
+	defer pool.Stop()
+
+	dir, err := ioutil.TempDir("", "go-exiftool")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	data, err := ioutil.ReadFile("testdata/IMG_7238.JPG")
+	if !assert.NoError(err) {
+		return
+	}
+
+	var files []string
+	for i := 0; i < 10; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("IMG_%d.JPG", i))
+		if !assert.NoError(ioutil.WriteFile(name, data, 0644)) {
+			return
+		}
+		files = append(files, name)
+	}
+
+	results, err := pool.ExtractBatch(files)
+	if !assert.NoError(err) || !assert.Len(results, len(files)) {
+		return
+	}
+
+	for i, r := range results {
+		assert.Equal(files[i], r.Filename)
+		if assert.NoError(r.Err) {
+			name, _ := r.Metadata.GetString("FileName")
+			assert.Equal(filepath.Base(files[i]), name)
+		}
+	}
+
+	results, err = pool.ExtractBatch(nil)
+	assert.NoError(err)
+	assert.Empty(results)
+}
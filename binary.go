@@ -0,0 +1,279 @@
+package exiftool
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// EnvPath is the environment variable Locate checks first for the path to
+// exiftool
+const EnvPath = "EXIFTOOL_PATH"
+
+// versionTimeout limits how long checking a binary's version may take
+const versionTimeout = 10 * time.Second
+
+var (
+	// ErrNotFound is returned by Locate when exiftool isn't installed in
+	// any of the places it looks
+	ErrNotFound = errors.New("exiftool not found")
+
+	// ErrInvalidVersion is returned when exiftool's -ver output can't be
+	// parsed
+	ErrInvalidVersion = errors.New("Invalid version")
+)
+
+// Version is an exiftool version like 12.40. Minor is the two digits after
+// the decimal point.
+type Version struct {
+	Major int
+	Minor int
+}
+
+// ParseVersion parses the version printed by `exiftool -ver`. Development
+// releases are printed with a suffix, like 12.41-dev, which is ignored.
+func ParseVersion(s string) (Version, error) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexFunc(s, func(r rune) bool { return r != '.' && (r < '0' || r > '9') }); i != -1 {
+		s = s[:i]
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || len(parts[1]) > 2 {
+		return Version{}, ErrInvalidVersion
+	}
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return Version{}, ErrInvalidVersion
+	}
+
+	// 9.9 is 9.90, not 9.09
+	minor, err := strconv.Atoi((parts[1] + "0")[:2])
+	if err != nil {
+		return Version{}, ErrInvalidVersion
+	}
+
+	return Version{Major: major, Minor: minor}, nil
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%02d", v.Major, v.Minor)
+}
+
+// Less returns true if v is older than o
+func (v Version) Less(o Version) bool {
+	if v.Major != o.Major {
+		return v.Major < o.Major
+	}
+	return v.Minor < o.Minor
+}
+
+// MinVersions are the exiftool releases that added the options this
+// package may use. Binary.Require checks them.
+var MinVersions = map[string]Version{
+	"-struct": {8, 44},
+	"-api":    {9, 59},
+	"-echo4":  {10, 2},
+}
+
+// VersionError is returned when a Binary is too old for an option
+type VersionError struct {
+	Option  string
+	Have    Version
+	Require Version
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("exiftool %s is required for %s, found %s", e.Require, e.Option, e.Have)
+}
+
+// Binary is an exiftool executable whose version is known. Use Locate or
+// NewBinary to find one before starting any processes so a missing or
+// broken exiftool is reported straight away rather than on the first
+// request.
+type Binary struct {
+	Path    string
+	Version Version
+}
+
+// Locate finds exiftool using the path in the EXIFTOOL_PATH environment
+// variable, the PATH, or common install locations, in that order, and
+// checks it can be run
+func Locate() (*Binary, error) {
+	if path := os.Getenv(EnvPath); path != "" {
+		b, err := NewBinary(path)
+		return b, errors.Wrap(err, EnvPath)
+	}
+
+	if path, err := exec.LookPath("exiftool"); err == nil {
+		return NewBinary(path)
+	}
+
+	for _, path := range commonLocations() {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return NewBinary(path)
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// commonLocations are where exiftool is installed by package managers and
+// installers that may not add it to the PATH
+func commonLocations() []string {
+	if runtime.GOOS == "windows" {
+		var paths []string
+		for _, env := range []string{"ProgramFiles", "ProgramFiles(x86)", "LOCALAPPDATA"} {
+			if dir := os.Getenv(env); dir != "" {
+				paths = append(paths,
+					filepath.Join(dir, "ExifTool", "exiftool.exe"),
+					filepath.Join(dir, "exiftool", "exiftool(-k).exe"))
+			}
+		}
+		return paths
+	}
+
+	return []string{
+		"/usr/local/bin/exiftool",
+		"/opt/homebrew/bin/exiftool",
+		"/opt/local/bin/exiftool",
+		"/usr/bin/exiftool",
+		"/usr/bin/vendor_perl/exiftool",
+		"/usr/share/perl5/vendor_perl/Image/ExifTool/exiftool",
+	}
+}
+
+// NewBinary runs the exiftool at path with -ver to check it works and
+// learn its version
+func NewBinary(path string) (*Binary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), versionTimeout)
+	defer cancel()
+
+	stdout, stderr, err := runOutput(ctx, path, nil, []string{"-ver"})
+	if err != nil {
+		if len(stderr) > 0 {
+			return nil, errors.Wrapf(err, "Failed running %s: %s", path, bytes.TrimSpace(stderr))
+		}
+		return nil, errors.Wrapf(err, "Failed running %s", path)
+	}
+
+	version, err := ParseVersion(string(stdout))
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s printed %q for -ver", path, bytes.TrimSpace(stdout))
+	}
+
+	return &Binary{Path: path, Version: version}, nil
+}
+
+// Supports returns true if the binary is new enough for option, which is a
+// key of MinVersions. Options without a minimum version are supported.
+func (b *Binary) Supports(option string) bool {
+	min, ok := MinVersions[option]
+	return !ok || !b.Version.Less(min)
+}
+
+// Require returns a *VersionError for the first option the binary is too
+// old for
+func (b *Binary) Require(options ...string) error {
+	for _, o := range options {
+		if !b.Supports(o) {
+			return &VersionError{Option: o, Have: b.Version, Require: MinVersions[o]}
+		}
+	}
+	return nil
+}
+
+// Command returns a Command that runs the binary
+func (b *Binary) Command() Command {
+	return Command(b.Path)
+}
+
+// Diagnostics describes an exiftool installation for bug reports and
+// health checks
+type Diagnostics struct {
+	Path        string
+	Version     Version
+	PerlVersion string
+	Platform    string
+
+	// Libraries are the optional perl modules exiftool found, with their
+	// versions
+	Libraries map[string]string
+
+	// ConfigFile is the user configuration file exiftool loads, or empty
+	// if there isn't one
+	ConfigFile string
+}
+
+// Diagnostics runs the binary with -ver -v to describe its installation
+func (b *Binary) Diagnostics(ctx context.Context) (*Diagnostics, error) {
+	stdout, _, err := runOutput(ctx, b.Path, nil, []string{"-ver", "-v"})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed running exiftool -ver -v")
+	}
+
+	d := parseDiagnostics(stdout)
+	d.Path = b.Path
+	d.Version = b.Version
+	d.ConfigFile = configFile()
+	return d, nil
+}
+
+// parseDiagnostics reads the output of -ver -v, which looks like:
+//
+//	ExifTool version 12.40
+//	Perl version 5.034000 (-C0)
+//	Platform: linux
+//	Optional libraries:
+//	  Archive::Zip       1.68
+func parseDiagnostics(data []byte) *Diagnostics {
+	d := &Diagnostics{Libraries: map[string]string{}}
+
+	libraries := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "Perl version "):
+			d.PerlVersion = strings.Fields(line)[2]
+		case strings.HasPrefix(line, "Platform:"):
+			d.Platform = strings.TrimSpace(strings.TrimPrefix(line, "Platform:"))
+		case strings.HasPrefix(line, "Optional libraries:"):
+			libraries = true
+		case libraries && trimmed != "" && trimmed != line:
+			if f := strings.Fields(trimmed); len(f) == 2 {
+				d.Libraries[f[0]] = f[1]
+			}
+		default:
+			libraries = false
+		}
+	}
+	return d
+}
+
+// configFile finds the configuration file exiftool loads by default, which
+// is .ExifTool_config in $EXIFTOOL_HOME or the home directory
+func configFile() string {
+	for _, dir := range []string{os.Getenv("EXIFTOOL_HOME"), os.Getenv("HOME"), os.Getenv("USERPROFILE")} {
+		if dir == "" {
+			continue
+		}
+		path := filepath.Join(dir, ".ExifTool_config")
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
@@ -0,0 +1,118 @@
+package exiftool
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		in   string
+		want Version
+	}{
+		{"12.40\n", Version{12, 40}},
+		{"9.9", Version{9, 90}},
+		{"10.02", Version{10, 2}},
+		{"12.41-dev", Version{12, 41}},
+	}
+	for _, test := range tests {
+		v, err := ParseVersion(test.in)
+		if assert.NoError(err, test.in) {
+			assert.Equal(test.want, v, test.in)
+		}
+	}
+
+	for _, in := range []string{"", "12", "twelve", "12.400", ".40"} {
+		_, err := ParseVersion(in)
+		assert.Equal(ErrInvalidVersion, err, in)
+	}
+
+	assert.Equal("10.02", Version{10, 2}.String())
+	assert.True(Version{9, 90}.Less(Version{10, 2}))
+	assert.False(Version{12, 40}.Less(Version{12, 40}))
+}
+
+func TestBinaryRequire(t *testing.T) {
+	assert := assert.New(t)
+
+	b := &Binary{Path: "exiftool", Version: Version{9, 70}}
+	assert.True(b.Supports("-api"))
+	assert.False(b.Supports("-echo4"))
+	assert.True(b.Supports("-json"))
+
+	assert.NoError(b.Require("-struct", "-api"))
+	err := b.Require("-api", "-echo4")
+	if assert.IsType(&VersionError{}, err) {
+		assert.Equal("exiftool 10.02 is required for -echo4, found 9.70", err.Error())
+	}
+
+	_, err = NewStayOpenBinary(b)
+	assert.IsType(&VersionError{}, err)
+
+	_, err = NewPoolConfig(PoolConfig{Binary: b, Size: 1})
+	assert.IsType(&VersionError{}, err)
+}
+
+func TestNewBinary(t *testing.T) {
+	assert := assert.New(t)
+
+	b, err := NewBinary("exiftool")
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal("exiftool", b.Path)
+	assert.False(b.Version.Less(Version{10, 2}))
+
+	stayopen, err := NewStayOpenBinary(b)
+	if assert.NoError(err) {
+		defer stayopen.Stop()
+		_, err = stayopen.Extract("testdata/IMG_7238.JPG")
+		assert.NoError(err)
+	}
+
+	_, err = NewBinary("testdata/not-exiftool")
+	assert.Error(err)
+}
+
+func TestLocate(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Setenv(EnvPath, os.Getenv(EnvPath))
+
+	os.Setenv(EnvPath, "testdata/not-exiftool")
+	_, err := Locate()
+	assert.Error(err)
+
+	os.Setenv(EnvPath, "")
+	b, err := Locate()
+	if assert.NoError(err) {
+		d, err := b.Diagnostics(context.Background())
+		if assert.NoError(err) {
+			assert.Equal(b.Path, d.Path)
+			assert.Equal(b.Version, d.Version)
+		}
+	}
+}
+
+func TestParseDiagnostics(t *testing.T) {
+	assert := assert.New(t)
+
+	d := parseDiagnostics([]byte(`ExifTool version 12.40
+Perl version 5.034000 (-C0)
+Platform: linux
+Optional libraries:
+  Archive::Zip       1.68
+  Compress::Zlib     2.102
+Include directories:
+  /etc/perl
+`))
+
+	assert.Equal("5.034000", d.PerlVersion)
+	assert.Equal("linux", d.Platform)
+	assert.Equal(map[string]string{"Archive::Zip": "1.68", "Compress::Zlib": "2.102"}, d.Libraries)
+}
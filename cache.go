@@ -0,0 +1,291 @@
+package exiftool
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheConfig bounds the memory a Cache uses. Zero values mean no limit.
+type CacheConfig struct {
+	// MaxEntries is the most responses kept
+	MaxEntries int
+
+	// MaxBytes is the most bytes of output, warnings and keys kept.
+	// Responses larger than MaxBytes aren't cached.
+	MaxBytes int64
+
+	// TTL is how long a response is used for. Files are also extracted
+	// again whenever their size or modification time changes.
+	TTL time.Duration
+}
+
+// CacheStats counts how a Cache's requests were handled
+type CacheStats struct {
+	Hits   int64
+	Misses int64
+
+	// Shared is the number of requests that waited for an identical
+	// request in flight rather than calling exiftool themselves
+	Shared int64
+
+	// Evictions is the number of responses dropped to stay within
+	// MaxEntries or MaxBytes, and Expirations those older than the TTL
+	Evictions   int64
+	Expirations int64
+
+	Entries int
+	Bytes   int64
+}
+
+// Cache is an Extractor that remembers the responses of another Extractor,
+// such as a Stayopen or Pool, in memory. Responses are keyed by the file's
+// path, size, modification time and inode along with the flags, which are
+// compared without regard to their order or the case of option names. The
+// least recently used responses are evicted first. Errors aren't cached.
+type Cache struct {
+	extractor Extractor
+	config    CacheConfig
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	calls   map[string]*cacheCall
+	stats   CacheStats
+
+	// now is replaced by tests
+	now func() time.Time
+}
+
+type cacheEntry struct {
+	key      string
+	data     []byte
+	warnings []Warning
+	size     int64
+	expires  time.Time
+}
+
+// cacheCall is a request in flight that identical requests wait for
+type cacheCall struct {
+	done     chan struct{}
+	data     []byte
+	warnings []Warning
+	err      error
+}
+
+// NewCache returns a Cache in front of e
+func NewCache(e Extractor, config CacheConfig) *Cache {
+	return &Cache{
+		extractor: e,
+		config:    config,
+		lru:       list.New(),
+		entries:   make(map[string]*list.Element),
+		calls:     make(map[string]*cacheCall),
+		now:       time.Now,
+	}
+}
+
+// ExtractWarnings returns the cached response for filename and flags, or
+// gets it from the underlying Extractor. The returned slices must not be
+// modified.
+func (c *Cache) ExtractWarnings(ctx context.Context, filename string, flags ...string) ([]byte, []Warning, error) {
+	key, ok := cacheKey(filename, flags)
+	if !ok {
+		// let the extractor report why the file can't be read
+		return c.extractor.ExtractWarnings(ctx, filename, flags...)
+	}
+
+	for {
+		c.mu.Lock()
+		if data, warnings, ok := c.lookup(key); ok {
+			c.stats.Hits++
+			c.mu.Unlock()
+			return data, warnings, nil
+		}
+
+		call, shared := c.calls[key]
+		if !shared {
+			call = &cacheCall{done: make(chan struct{})}
+			c.calls[key] = call
+			c.stats.Misses++
+		} else {
+			c.stats.Shared++
+		}
+		c.mu.Unlock()
+
+		if !shared {
+			return c.fill(ctx, key, call, filename, flags)
+		}
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+
+		// the request that was waited for gave up, which isn't a reason
+		// for this one to
+		if (call.err == context.Canceled || call.err == context.DeadlineExceeded) && ctx.Err() == nil {
+			continue
+		}
+		return call.data, call.warnings, call.err
+	}
+}
+
+// ExtractMetadata is like ExtractWarnings with -json but parses the output
+func (c *Cache) ExtractMetadata(ctx context.Context, filename string, flags ...string) (*Metadata, error) {
+	data, warnings, err := c.ExtractWarnings(ctx, filename, append(flags[:len(flags):len(flags)], "-json")...)
+	if err != nil {
+		return nil, err
+	}
+	return parseSingleMetadata(data, warnings)
+}
+
+// fill calls the extractor for a miss and shares the result with the
+// requests waiting for it
+func (c *Cache) fill(ctx context.Context, key string, call *cacheCall, filename string, flags []string) ([]byte, []Warning, error) {
+	call.data, call.warnings, call.err = c.extractor.ExtractWarnings(ctx, filename, flags...)
+
+	c.mu.Lock()
+	delete(c.calls, key)
+	if call.err == nil {
+		c.add(key, call.data, call.warnings)
+	}
+	c.mu.Unlock()
+
+	close(call.done)
+	return call.data, call.warnings, call.err
+}
+
+// lookup returns a cached response and marks it as recently used. The lock
+// must be held.
+func (c *Cache) lookup(key string) ([]byte, []Warning, bool) {
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, nil, false
+	}
+
+	e := el.Value.(*cacheEntry)
+	if !e.expires.IsZero() && !c.now().Before(e.expires) {
+		c.remove(el)
+		c.stats.Expirations++
+		return nil, nil, false
+	}
+
+	c.lru.MoveToFront(el)
+	return e.data, e.warnings, true
+}
+
+// add caches a response and evicts the least recently used ones beyond the
+// limits. The lock must be held.
+func (c *Cache) add(key string, data []byte, warnings []Warning) {
+	size := int64(len(key) + len(data))
+	for _, w := range warnings {
+		size += int64(len(w.Message))
+	}
+	if c.config.MaxBytes > 0 && size > c.config.MaxBytes {
+		return
+	}
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+
+	e := &cacheEntry{key: key, data: data, warnings: warnings, size: size}
+	if c.config.TTL > 0 {
+		e.expires = c.now().Add(c.config.TTL)
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	c.stats.Entries++
+	c.stats.Bytes += size
+
+	for (c.config.MaxEntries > 0 && c.stats.Entries > c.config.MaxEntries) ||
+		(c.config.MaxBytes > 0 && c.stats.Bytes > c.config.MaxBytes) {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+// remove drops an entry. The lock must be held.
+func (c *Cache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, e.key)
+	c.stats.Entries--
+	c.stats.Bytes -= e.size
+}
+
+// Stats returns how the cache's requests were handled so far
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// Purge drops every cached response
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+	}
+}
+
+// cacheKey identifies a response by the file and the normalized flags. It
+// returns false if the file can't be examined.
+func cacheKey(filename string, flags []string) (string, bool) {
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		return "", false
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", false
+	}
+
+	return fmt.Sprintf("%s\x00%d\x00%d\x00%d\x00%s", path, info.Size(), info.ModTime().UnixNano(),
+		inode(info), strings.Join(normalizeFlags(flags), "\x00")), true
+}
+
+// flagValues are the options that take the next argument as their value,
+// in lower case
+var flagValues = map[string]bool{
+	"-api": true, "-c": true, "-charset": true, "-coordformat": true,
+	"-d": true, "-dateformat": true, "-echo": true, "-echo1": true,
+	"-echo2": true, "-echo3": true, "-echo4": true, "-ext": true,
+	"-extension": true, "-fileorder": true, "-i": true, "-ignore": true,
+	"-lang": true, "-p": true, "-password": true, "-printformat": true,
+	"-sep": true, "-separator": true, "-x": true, "-exclude": true,
+}
+
+// normalizeFlags returns flags as a sorted set with options in lower case,
+// except single letter ones like -G and -g which differ by case, and
+// options that take a value kept with it
+func normalizeFlags(flags []string) []string {
+	seen := make(map[string]bool, len(flags))
+	units := make([]string, 0, len(flags))
+	for i := 0; i < len(flags); i++ {
+		unit := flags[i]
+		if strings.HasPrefix(unit, "-") {
+			if len(optionName(unit)) > 1 {
+				unit = strings.ToLower(unit)
+			}
+			if flagValues[unit] && i+1 < len(flags) {
+				i++
+				unit += "\x01" + flags[i]
+			}
+		}
+		if !seen[unit] {
+			seen[unit] = true
+			units = append(units, unit)
+		}
+	}
+	sort.Strings(units)
+	return units
+}
@@ -0,0 +1,247 @@
+package exiftool
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingExtractor returns the filename as its output and counts
+// its calls. When block is set each call waits for it to be closed.
+type countingExtractor struct {
+	sync.Mutex
+	calls int
+	block chan struct{}
+}
+
+func (e *countingExtractor) ExtractWarnings(ctx context.Context, filename string, flags ...string) ([]byte, []Warning, error) {
+	e.Lock()
+	e.calls++
+	block := e.block
+	e.Unlock()
+
+	if block != nil {
+		select {
+		case <-block:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+	return []byte(fmt.Sprintf(`[{"SourceFile": %q}]`, filename)), nil, nil
+}
+
+func (e *countingExtractor) ExtractMetadata(ctx context.Context, filename string, flags ...string) (*Metadata, error) {
+	data, warnings, err := e.ExtractWarnings(ctx, filename, flags...)
+	if err != nil {
+		return nil, err
+	}
+	return parseSingleMetadata(data, warnings)
+}
+
+func (e *countingExtractor) count() int {
+	e.Lock()
+	defer e.Unlock()
+	return e.calls
+}
+
+// cacheFiles creates n small files in a new directory
+func cacheFiles(t *testing.T, n int) (string, []string) {
+	dir, err := ioutil.TempDir("", "go-exiftool")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var files []string
+	for i := 0; i < n; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("%d.jpg", i))
+		if err := ioutil.WriteFile(name, []byte("jpeg"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, name)
+	}
+	return dir, files
+}
+
+func TestCache(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, files := cacheFiles(t, 1)
+	defer os.RemoveAll(dir)
+
+	e := &countingExtractor{}
+	c := NewCache(e, CacheConfig{})
+	ctx := context.Background()
+
+	m, err := c.ExtractMetadata(ctx, files[0], "-Make", "-d", "%Y")
+	if assert.NoError(err) {
+		source, _ := m.GetString("SourceFile")
+		assert.Equal(files[0], source)
+	}
+
+	// the same flags in another order and case share the entry
+	_, err = c.ExtractMetadata(ctx, files[0], "-d", "%Y", "-make")
+	assert.NoError(err)
+	assert.Equal(1, e.count())
+
+	// but a different date format doesn't
+	_, err = c.ExtractMetadata(ctx, files[0], "-Make", "-d", "%m")
+	assert.NoError(err)
+	assert.Equal(2, e.count())
+
+	// changing the file changes its identity
+	later := time.Now().Add(time.Hour)
+	assert.NoError(os.Chtimes(files[0], later, later))
+	_, err = c.ExtractMetadata(ctx, files[0], "-Make", "-d", "%Y")
+	assert.NoError(err)
+	assert.Equal(3, e.count())
+
+	// files that can't be examined go straight to the extractor
+	_, err = c.ExtractMetadata(ctx, filepath.Join(dir, "missing.jpg"))
+	assert.NoError(err)
+	assert.Equal(4, e.count())
+
+	stats := c.Stats()
+	assert.Equal(int64(1), stats.Hits)
+	assert.Equal(int64(3), stats.Misses)
+	assert.Equal(3, stats.Entries)
+
+	c.Purge()
+	assert.Equal(0, c.Stats().Entries)
+	assert.Equal(int64(0), c.Stats().Bytes)
+}
+
+func TestCacheEviction(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, files := cacheFiles(t, 4)
+	defer os.RemoveAll(dir)
+
+	e := &countingExtractor{}
+	c := NewCache(e, CacheConfig{MaxEntries: 2})
+	ctx := context.Background()
+
+	for _, f := range files[:3] {
+		c.ExtractWarnings(ctx, f)
+	}
+	stats := c.Stats()
+	assert.Equal(2, stats.Entries)
+	assert.Equal(int64(1), stats.Evictions)
+
+	// files[0] was the least recently used
+	c.ExtractWarnings(ctx, files[2])
+	c.ExtractWarnings(ctx, files[0])
+	assert.Equal(4, e.count())
+
+	// the files' entries are about the same size and two and a half fit
+	size := c.Stats().Bytes / 2
+	c = NewCache(e, CacheConfig{MaxBytes: size*2 + size/2})
+	for _, f := range files {
+		c.ExtractWarnings(ctx, f)
+	}
+	stats = c.Stats()
+	assert.Equal(2, stats.Entries)
+	assert.Equal(int64(2), stats.Evictions)
+	assert.True(stats.Bytes <= size*2+size/2)
+
+	// responses larger than MaxBytes aren't cached at all
+	c = NewCache(e, CacheConfig{MaxBytes: 10})
+	c.ExtractWarnings(ctx, files[0])
+	assert.Equal(0, c.Stats().Entries)
+}
+
+func TestCacheTTL(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, files := cacheFiles(t, 1)
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	e := &countingExtractor{}
+	c := NewCache(e, CacheConfig{TTL: time.Minute})
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	c.ExtractWarnings(ctx, files[0])
+	now = now.Add(59 * time.Second)
+	c.ExtractWarnings(ctx, files[0])
+	assert.Equal(1, e.count())
+
+	now = now.Add(time.Second)
+	c.ExtractWarnings(ctx, files[0])
+	assert.Equal(2, e.count())
+	assert.Equal(int64(1), c.Stats().Expirations)
+}
+
+func TestCacheShared(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, files := cacheFiles(t, 1)
+	defer os.RemoveAll(dir)
+
+	e := &countingExtractor{block: make(chan struct{})}
+	c := NewCache(e, CacheConfig{})
+
+	// the first request gives up while the others wait for it
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, _, err := c.ExtractWarnings(ctx, files[0])
+		first <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, _, err := c.ExtractWarnings(context.Background(), files[0])
+			assert.NoError(err)
+			assert.NotEmpty(data)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	assert.Equal(context.Canceled, <-first)
+
+	time.Sleep(50 * time.Millisecond)
+	close(e.block)
+	wg.Wait()
+
+	// one waiter took over from the canceled request
+	assert.Equal(2, e.count())
+	stats := c.Stats()
+	assert.Equal(int64(2), stats.Misses)
+	assert.True(stats.Shared >= 5)
+}
+
+func TestCacheStayOpen(t *testing.T) {
+	assert := assert.New(t)
+
+	stayopen, err := NewStayOpen("exiftool")
+	if !assert.NoError(err) {
+		return
+	}
+	defer stayopen.Stop()
+
+	c := NewCache(stayopen, CacheConfig{MaxEntries: 10})
+	for i := 0; i < 3; i++ {
+		m, err := c.ExtractMetadata(context.Background(), "testdata/IMG_7238.JPG", "-ShutterSpeed")
+		if assert.NoError(err) {
+			ss, _ := m.GetString("ShutterSpeed")
+			assert.Equal("1/123", ss)
+		}
+	}
+
+	stats := c.Stats()
+	assert.Equal(int64(1), stats.Misses)
+	assert.Equal(int64(2), stats.Hits)
+}
@@ -1,16 +1,18 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
-	"path/filepath"
 	"time"
 
 	exiftool "github.com/mostlygeek/go-exiftool"
 )
 
 func main() {
+	compare := flag.Bool("compare", false, "compare extracting one file per request with batched requests")
+	batchSize := flag.Int("batch", 50, "files per request in batched mode")
 	flag.Parse()
 
 	dir := flag.Arg(0)
@@ -27,25 +29,48 @@ func main() {
 
 	defer et.Stop()
 
-	fmt.Println("Starting.... ")
-	start := time.Now()
-	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	scan, err := exiftool.Scan(context.Background(), dir, exiftool.ScanOptions{})
+	if err != nil {
+		fmt.Println("Scan ERROR: ", err.Error())
+		os.Exit(1)
+	}
 
-		if info.IsDir() {
-			return nil
+	var files []string
+	for r := range scan.Results() {
+		if r.Err != nil {
+			fmt.Println("Scan ERROR: ", r.Err.Error())
+			os.Exit(1)
 		}
+		files = append(files, r.Filename)
+	}
 
+	fmt.Println("Starting.... ")
+	start := time.Now()
+	for _, path := range files {
 		et.Extract(path)
-		return nil
-	})
+	}
+	single := time.Now().Sub(start)
+	fmt.Printf("Took: %v (%d files)\n", single, len(files))
 
-	if err != nil {
-		fmt.Println("Walk ERROR: ", err.Error())
-		os.Exit(1)
+	if !*compare || *batchSize < 1 {
+		return
+	}
+
+	start = time.Now()
+	for i := 0; i < len(files); i += *batchSize {
+		end := i + *batchSize
+		if end > len(files) {
+			end = len(files)
+		}
+		if _, err := et.ExtractBatch(files[i:end]); err != nil {
+			fmt.Println("Batch ERROR: ", err.Error())
+			os.Exit(1)
+		}
 	}
+	batched := time.Now().Sub(start)
+	fmt.Printf("Batched took: %v (%d files per request)\n", batched, *batchSize)
 
-	fmt.Printf("Took: %v\n", time.Now().Sub(start))
+	if batched > 0 {
+		fmt.Printf("Speedup: %.2fx\n", float64(single)/float64(batched))
+	}
 }
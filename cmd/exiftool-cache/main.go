@@ -0,0 +1,85 @@
+// exiftool-cache maintains a directory used by exiftool.DiskCache
+//
+//	exiftool-cache -dir DIR verify             report invalid entries
+//	exiftool-cache -dir DIR prune              remove invalid entries
+//	exiftool-cache -dir DIR [-max-bytes N] compact
+//
+// Entries are checked against the version of the exiftool found by
+// exiftool.Locate unless -version is given.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	exiftool "github.com/mostlygeek/go-exiftool"
+)
+
+func main() {
+	dir := flag.String("dir", "", "cache directory")
+	version := flag.String("version", "", "exiftool version the entries should be from")
+	maxBytes := flag.Int64("max-bytes", 0, "size to compact the cache to, 0 only removes partial entries")
+	flag.Parse()
+
+	if *dir == "" || flag.NArg() != 1 {
+		fmt.Println("Usage: exiftool-cache -dir DIR [flags] verify|prune|compact")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	var v exiftool.Version
+	var err error
+	if *version != "" {
+		v, err = exiftool.ParseVersion(*version)
+	} else {
+		var b *exiftool.Binary
+		if b, err = exiftool.Locate(); err == nil {
+			v = b.Version
+		}
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+
+	// the cache is only maintained, never used for extraction
+	cache, err := exiftool.NewDiskCache(nil, exiftool.DiskCacheConfig{Dir: *dir, Version: v})
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		cancel()
+	}()
+
+	switch flag.Arg(0) {
+	case "verify", "prune":
+		report, err := cache.Verify(ctx, flag.Arg(0) == "prune")
+		if err != nil {
+			fmt.Println("Error: ", err.Error())
+			os.Exit(1)
+		}
+		fmt.Printf("Entries: %d valid: %d corrupt: %d stale: %d outdated: %d removed: %d\n",
+			report.Entries, report.Valid, report.Corrupt, report.Stale, report.Outdated, report.Removed)
+	case "compact":
+		report, err := cache.Compact(ctx, *maxBytes)
+		if err != nil {
+			fmt.Println("Error: ", err.Error())
+			os.Exit(1)
+		}
+		fmt.Printf("Entries: %d (%d bytes) removed: %d (%d bytes) partial entries removed: %d\n",
+			report.Entries, report.Bytes, report.Removed, report.RemovedBytes, report.TempFiles)
+	default:
+		fmt.Println("Error: unknown command", flag.Arg(0))
+		os.Exit(2)
+	}
+}
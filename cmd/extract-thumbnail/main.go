@@ -1,7 +1,7 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"io"
@@ -11,18 +11,26 @@ import (
 )
 
 func main() {
+	largest := flag.Bool("largest", false, "extract the largest embedded preview instead of the thumbnail")
 	flag.Parse()
-	meta, err := exiftool.Extract(flag.Arg(0))
+
+	ctx := context.Background()
+
+	var (
+		image *exiftool.Image
+		err   error
+	)
+	if *largest {
+		image, err = exiftool.LargestPreview(ctx, "exiftool", flag.Arg(0))
+	} else {
+		image, err = exiftool.ExtractImage(ctx, "exiftool", flag.Arg(0), "ThumbnailImage")
+	}
+
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
 		os.Exit(1)
-	} else {
-		thumb, err := meta.GetBytes("ThumbnailImage")
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-			os.Exit(1)
-		} else {
-			io.Copy(os.Stdout, bytes.NewBuffer(thumb))
-		}
 	}
+
+	fmt.Fprintf(os.Stderr, "%s: %d bytes, %s\n", image.Tag, image.Size, image.MIMEType)
+	io.Copy(os.Stdout, image)
 }
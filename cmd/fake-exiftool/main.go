@@ -0,0 +1,9 @@
+// fake-exiftool stands in for exiftool in tests. It answers with the
+// responses in the exiftooltest script named by $EXIFTOOLTEST_SCRIPT.
+package main
+
+import "github.com/mostlygeek/go-exiftool/exiftooltest"
+
+func main() {
+	exiftooltest.Main()
+}
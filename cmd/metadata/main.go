@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
@@ -11,7 +12,13 @@ import (
 func main() {
 
 	flag.Parse()
-	meta, err := exiftool.Extract(flag.Arg(0))
+	binary, err := exiftool.Locate()
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	meta, err := binary.Command().ExtractMetadata(context.Background(), flag.Arg(0))
 	if err != nil {
 		fmt.Println(err.Error())
 		os.Exit(1)
@@ -1,39 +1,67 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"runtime"
+	"strings"
 
 	exiftool "github.com/mostlygeek/go-exiftool"
-	"github.com/stretchr/powerwalk"
 )
 
 func main() {
-
+	mimeTypes := flag.String("mime", "", "comma separated MIME types to extract, such as image/*")
+	followLinks := flag.Bool("follow", false, "follow symbolic links")
 	flag.Parse()
 	root := flag.Arg(0)
 	parallelism := runtime.NumCPU() * 2
 
-	exif := exiftool.NewPool("exiftool", parallelism)
-	//exif := exiftool.NewStayopen("exiftool")
+	exif, err := exiftool.NewPool("exiftool", parallelism)
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+	defer exif.Stop()
 
-	walkFn := func(path string, info os.FileInfo, err error) error {
-		if info.IsDir() {
-			return nil
-		}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		cancel()
+	}()
+
+	opts := exiftool.ScanOptions{Extractor: exif}
+	if *mimeTypes != "" {
+		opts.MIMETypes = strings.Split(*mimeTypes, ",")
+	}
+	if *followLinks {
+		opts.Symlinks = exiftool.FollowSymlinks
+	}
+
+	scan, err := exiftool.Scan(ctx, root, opts)
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
 
-		metadata, err := exif.Extract(path)
-		if err != nil {
-			fmt.Println("FAIL", path, err.Error())
+	for r := range scan.Results() {
+		if r.Err != nil {
+			fmt.Println("FAIL", r.Filename, r.Err.Error())
 		} else {
-			fmt.Println("OK", path, "mime:", metadata.MIMEType())
+			fmt.Println("OK", r.Filename, "mime:", r.Metadata.MIMEType())
 		}
-
-		return nil
 	}
 
-	powerwalk.WalkLimit(root, walkFn, parallelism)
-	exif.Stop()
+	p := scan.Progress()
+	fmt.Printf("Found: %d processed: %d failed: %d skipped: %d (%d bytes) in %v\n",
+		p.Found, p.Processed, p.Failed, p.Skipped, p.ProcessedBytes, p.Elapsed)
+	if err := scan.Err(); err != nil {
+		fmt.Println("Stopped: ", err.Error())
+		os.Exit(1)
+	}
 }
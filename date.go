@@ -0,0 +1,223 @@
+package exiftool
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// dateLayouts are the formats exiftool prints dates and times in. Fractional
+// seconds are accepted by time.Parse without being in the layout.
+var dateLayouts = []struct {
+	layout string
+	zone   bool
+}{
+	{"2006:01:02 15:04:05Z07:00", true},
+	{"2006:01:02 15:04:05", false},
+	{"2006:01:02 15:04Z07:00", true},
+	{"2006:01:02 15:04", false},
+	{"2006-01-02T15:04:05Z07:00", true},
+	{"2006-01-02T15:04:05", false},
+	{"2006:01:02", false},
+}
+
+// parseDate parses a date in one of the formats exiftool prints. Dates
+// without a time zone are returned in UTC with zoneKnown set to false.
+// Unset dates, such as `0000:00:00 00:00:00`, return the zero time.Time
+// and no error.
+func parseDate(s string) (t time.Time, zoneKnown bool, err error) {
+	s = strings.TrimSpace(s)
+	if isUnsetDate(s) {
+		return time.Time{}, false, nil
+	}
+
+	for _, l := range dateLayouts {
+		if t, err := time.Parse(l.layout, s); err == nil {
+			return t, l.zone, nil
+		}
+	}
+
+	return time.Time{}, false, errors.Errorf("Unrecognized date format %q", s)
+}
+
+// isUnsetDate returns true for the placeholders cameras write when the
+// clock was never set, which contain no digits other than zeros
+func isUnsetDate(s string) bool {
+	return strings.Trim(s, "0: -T.Z+") == ""
+}
+
+// DateTime is a date assembled from one or more date and time tags
+type DateTime struct {
+	time.Time
+
+	// Sources lists the tags the date was assembled from
+	Sources []string
+
+	// ZoneKnown is false when none of the sources had time zone
+	// information. Time then holds the camera's clock time in UTC.
+	ZoneKnown bool
+}
+
+// dateSource describes tags that together make up a date
+type dateSource struct {
+	date   string
+	clock  string // time of day when date only holds the date
+	subsec string
+	offset string
+	utc    bool // the tags are always in UTC
+}
+
+// dateTakenSources are the tags DateTaken tries, in order
+var dateTakenSources = []dateSource{
+	{date: "SubSecDateTimeOriginal"},
+	{date: "DateTimeOriginal", subsec: "SubSecTimeOriginal", offset: "OffsetTimeOriginal"},
+	{date: "SubSecCreateDate"},
+	{date: "CreateDate", subsec: "SubSecTimeDigitized", offset: "OffsetTimeDigitized"},
+	{date: "MediaCreateDate", utc: true},
+	{date: "GPSDateTime", utc: true},
+	{date: "GPSDateStamp", clock: "GPSTimeStamp", utc: true},
+}
+
+// GetTime returns a date tag as a time.Time. Dates without a time zone are
+// returned in UTC. Unset dates, such as `0000:00:00 00:00:00`, return the
+// zero time.Time and no error.
+func (m *Metadata) GetTime(tag string) (time.Time, error) {
+	s, err := m.GetString(tag)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	t, _, err := parseDate(s)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, tag)
+	}
+	return t, nil
+}
+
+// DateTaken returns when the photo or video was taken using the first of
+// these that is set:
+//
+//  1. SubSecDateTimeOriginal
+//  2. DateTimeOriginal with SubSecTimeOriginal and OffsetTimeOriginal
+//  3. SubSecCreateDate
+//  4. CreateDate with SubSecTimeDigitized and OffsetTimeDigitized
+//  5. MediaCreateDate
+//  6. GPSDateTime
+//  7. GPSDateStamp with GPSTimeStamp
+//
+// QuickTime dates, including CreateDate for video files, and GPS dates are
+// stored in UTC so their zone is always known.
+//
+// ErrTagNotFound is returned if none of the tags exist. If they exist but
+// are all unset the returned DateTime IsZero and the error is nil. Dates
+// reformatted with -dateFormat can't be parsed.
+func (m *Metadata) DateTaken() (DateTime, error) {
+	found := false
+	for _, src := range dateTakenSources {
+		d, ok, err := m.dateFrom(src)
+		if err != nil {
+			return DateTime{}, err
+		}
+
+		if !ok {
+			continue
+		}
+
+		found = true
+		if !d.IsZero() {
+			return d, nil
+		}
+	}
+
+	if !found {
+		return DateTime{}, ErrTagNotFound
+	}
+	return DateTime{}, nil
+}
+
+// dateFrom assembles a date from the tags in src. ok is false when the
+// tags don't exist.
+func (m *Metadata) dateFrom(src dateSource) (d DateTime, ok bool, err error) {
+	key, ok := m.key(src.date)
+	if !ok {
+		return DateTime{}, false, nil
+	}
+
+	s, err := m.GetString(key)
+	if err != nil {
+		return DateTime{}, true, err
+	}
+	d.Sources = []string{key}
+
+	if src.clock != "" {
+		clockKey, ok := m.key(src.clock)
+		if !ok {
+			return DateTime{}, false, nil
+		}
+		clock, err := m.GetString(clockKey)
+		if err != nil {
+			return DateTime{}, true, err
+		}
+		s += " " + clock
+		d.Sources = append(d.Sources, clockKey)
+	}
+
+	// an unset date stays unset whatever the sub-second and offset tags
+	// say, so it can fall back to the next source
+	if isUnsetDate(strings.TrimSpace(s)) {
+		return DateTime{}, true, nil
+	}
+
+	if _, zone, err := parseDate(s); err == nil && !zone {
+		if sub, subKey := m.optionalString(src.subsec); sub != "" && !strings.Contains(s, ".") {
+			s += "." + sub
+			d.Sources = append(d.Sources, subKey)
+		}
+		if offset, offsetKey := m.optionalString(src.offset); offset != "" {
+			s += offset
+			d.Sources = append(d.Sources, offsetKey)
+		}
+	}
+
+	t, zone, err := parseDate(s)
+	if err != nil {
+		return DateTime{}, true, errors.Wrap(err, key)
+	}
+
+	if t.IsZero() {
+		return DateTime{}, true, nil
+	}
+
+	d.Time = t
+	d.ZoneKnown = zone || src.utc || m.isQuickTime(key)
+	return d, true, nil
+}
+
+// optionalString returns the trimmed value of tag and the name it was
+// found under, or empty strings if it is missing
+func (m *Metadata) optionalString(tag string) (string, string) {
+	if tag == "" {
+		return "", ""
+	}
+
+	key, ok := m.key(tag)
+	if !ok {
+		return "", ""
+	}
+
+	s, err := m.GetString(key)
+	if err != nil {
+		return "", ""
+	}
+	return strings.TrimSpace(s), key
+}
+
+// isQuickTime returns true if key is a QuickTime tag, which are in UTC.
+// Without -G the file's MIME type is used to guess.
+func (m *Metadata) isQuickTime(key string) bool {
+	if strings.Contains(key, ":") {
+		return strings.HasPrefix(key, "QuickTime:")
+	}
+	return strings.HasPrefix(m.MIMEType(), "video/")
+}
@@ -0,0 +1,161 @@
+package exiftool
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDate(t *testing.T) {
+	assert := assert.New(t)
+
+	pst := time.FixedZone("", -7*3600)
+	tests := []struct {
+		in   string
+		out  time.Time
+		zone bool
+	}{
+		{"2016:06:17 19:16:43", time.Date(2016, 6, 17, 19, 16, 43, 0, time.UTC), false},
+		{"2016:06:17 19:16:43.25", time.Date(2016, 6, 17, 19, 16, 43, 250000000, time.UTC), false},
+		{"2016:06:17 19:16:43-07:00", time.Date(2016, 6, 17, 19, 16, 43, 0, pst), true},
+		{"2016:06:17 19:16:43.5-07:00", time.Date(2016, 6, 17, 19, 16, 43, 500000000, pst), true},
+		{"2016:06:18 02:16:43Z", time.Date(2016, 6, 18, 2, 16, 43, 0, time.UTC), true},
+		{"2016-06-17T19:16:43-07:00", time.Date(2016, 6, 17, 19, 16, 43, 0, pst), true},
+		{"2016:06:17", time.Date(2016, 6, 17, 0, 0, 0, 0, time.UTC), false},
+	}
+
+	for _, test := range tests {
+		out, zone, err := parseDate(test.in)
+		if assert.NoError(err, test.in) {
+			assert.True(test.out.Equal(out), test.in)
+			assert.Equal(test.zone, zone, test.in)
+		}
+	}
+
+	for _, unset := range []string{"", "0000:00:00 00:00:00", "0000:00:00", "    :  :     :  :  "} {
+		out, _, err := parseDate(unset)
+		assert.NoError(err, unset)
+		assert.True(out.IsZero(), unset)
+	}
+
+	_, _, err := parseDate("yesterday")
+	assert.Error(err)
+}
+
+func TestDateTaken(t *testing.T) {
+	assert := assert.New(t)
+
+	pst := time.FixedZone("", -7*3600)
+	tests := []struct {
+		json    string
+		out     time.Time
+		zone    bool
+		sources []string
+	}{
+		{
+			`{"SubSecDateTimeOriginal": "2016:06:17 19:16:43.25-07:00", "DateTimeOriginal": "2016:06:17 19:16:43"}`,
+			time.Date(2016, 6, 17, 19, 16, 43, 250000000, pst), true,
+			[]string{"SubSecDateTimeOriginal"},
+		},
+		{
+			`{"EXIF:DateTimeOriginal": "2016:06:17 19:16:43", "EXIF:SubSecTimeOriginal": "025", "EXIF:OffsetTimeOriginal": "-07:00"}`,
+			time.Date(2016, 6, 17, 19, 16, 43, 25000000, pst), true,
+			[]string{"EXIF:DateTimeOriginal", "EXIF:SubSecTimeOriginal", "EXIF:OffsetTimeOriginal"},
+		},
+		{
+			// unset original date falls back to CreateDate
+			`{"DateTimeOriginal": "0000:00:00 00:00:00", "CreateDate": "2016:06:17 19:16:43"}`,
+			time.Date(2016, 6, 17, 19, 16, 43, 0, time.UTC), false,
+			[]string{"CreateDate"},
+		},
+		{
+			// as do unset dates with a sub-second or offset tag
+			`{"DateTimeOriginal": "0000:00:00 00:00:00", "OffsetTimeOriginal": "+09:00", "CreateDate": "2016:06:17 19:16:43"}`,
+			time.Date(2016, 6, 17, 19, 16, 43, 0, time.UTC), false,
+			[]string{"CreateDate"},
+		},
+		{
+			`{"DateTimeOriginal": "0000:00:00 00:00:00", "SubSecTimeOriginal": "123", "CreateDate": "2016:06:17 19:16:43"}`,
+			time.Date(2016, 6, 17, 19, 16, 43, 0, time.UTC), false,
+			[]string{"CreateDate"},
+		},
+		{
+			`{"MIMEType": "video/quicktime", "CreateDate": "2016:06:18 02:16:43"}`,
+			time.Date(2016, 6, 18, 2, 16, 43, 0, time.UTC), true,
+			[]string{"CreateDate"},
+		},
+		{
+			`{"QuickTime:CreateDate": "0000:00:00 00:00:00", "QuickTime:MediaCreateDate": "2016:06:18 02:16:43"}`,
+			time.Date(2016, 6, 18, 2, 16, 43, 0, time.UTC), true,
+			[]string{"QuickTime:MediaCreateDate"},
+		},
+		{
+			`{"GPSDateStamp": "2016:06:18", "GPSTimeStamp": "02:16:43.5"}`,
+			time.Date(2016, 6, 18, 2, 16, 43, 500000000, time.UTC), true,
+			[]string{"GPSDateStamp", "GPSTimeStamp"},
+		},
+	}
+
+	for _, test := range tests {
+		list, err := ParseMetadata([]byte("[" + test.json + "]"))
+		if !assert.NoError(err) {
+			continue
+		}
+
+		d, err := list[0].DateTaken()
+		if assert.NoError(err, test.json) {
+			assert.True(test.out.Equal(d.Time), "%s: %s", test.json, d.Time)
+			assert.Equal(test.zone, d.ZoneKnown, test.json)
+			assert.Equal(test.sources, d.Sources, test.json)
+		}
+	}
+}
+
+func TestDateTakenUnset(t *testing.T) {
+	assert := assert.New(t)
+
+	list, err := ParseMetadata([]byte(`[{"DateTimeOriginal": "0000:00:00 00:00:00", "CreateDate": "    :  :     :  :  "}, {"Make": "Apple"}]`))
+	if !assert.NoError(err) {
+		return
+	}
+
+	d, err := list[0].DateTaken()
+	assert.NoError(err)
+	assert.True(d.IsZero())
+
+	_, err = list[1].DateTaken()
+	assert.Equal(ErrTagNotFound, err)
+}
+
+func TestGetTime(t *testing.T) {
+	assert := assert.New(t)
+
+	list, err := ParseMetadata([]byte(`[{"CreateDate": "2016:06:17 19:16:43", "ModifyDate": "bad"}]`))
+	if !assert.NoError(err) {
+		return
+	}
+
+	created, err := list[0].GetTime("CreateDate")
+	assert.NoError(err)
+	assert.Equal(time.Date(2016, 6, 17, 19, 16, 43, 0, time.UTC), created)
+
+	_, err = list[0].GetTime("ModifyDate")
+	assert.Error(err)
+}
+
+func TestDateTakenExtract(t *testing.T) {
+	assert := assert.New(t)
+
+	meta, err := ExtractMetadata(context.Background(), "exiftool", "testdata/IMG_7238.JPG", "-CreateDate")
+	if !assert.NoError(err) {
+		return
+	}
+
+	d, err := meta.DateTaken()
+	if assert.NoError(err) {
+		assert.Equal(time.Date(2016, 6, 17, 19, 16, 43, 0, time.UTC), d.Time)
+		assert.Equal([]string{"CreateDate"}, d.Sources)
+	}
+}
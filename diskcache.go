@@ -0,0 +1,553 @@
+package exiftool
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// diskTempPrefix starts the names of entries being written. Ones left by a
+// crash are removed by DiskCache.Compact.
+const diskTempPrefix = ".tmp-"
+
+// diskTempAge is how old a temporary file must be before Compact assumes it
+// was left by a crash rather than being written
+const diskTempAge = time.Hour
+
+// DiskCacheConfig describes where and how a DiskCache keeps responses
+type DiskCacheConfig struct {
+	// Dir is the directory entries are stored in. It is created if it
+	// doesn't exist.
+	Dir string
+
+	// Version is the version of exiftool the responses come from, such as
+	// Binary.Version. Entries from other versions are never used.
+	Version Version
+
+	// Flags are the common flags the Extractor was created with, such as
+	// those passed to NewPool, as they change its responses too
+	Flags []string
+
+	// HashContents identifies files by a SHA-256 hash of their contents
+	// rather than their path, size and modification time. Hashing reads
+	// every file but entries survive files being moved, copied or touched.
+	// An entry is used for any file with the same contents, with the
+	// SourceFile, FileName, Directory and FilePath tags of a JSON response
+	// changed to match. Other responses are only used for the file they
+	// came from. Tags of the file system such as FileModifyDate are those
+	// of the file first extracted. Verify never finds these entries stale,
+	// so use Compact to bound them.
+	HashContents bool
+}
+
+// DiskCacheStats counts how a DiskCache's requests were handled
+type DiskCacheStats struct {
+	Hits   int64
+	Misses int64
+
+	// Corrupt is the number of unreadable entries that were treated as
+	// misses and removed
+	Corrupt int64
+
+	// WriteErrors is the number of responses that couldn't be saved
+	WriteErrors int64
+}
+
+// DiskCache is an Extractor that saves the responses of another Extractor
+// in a directory so they survive restarts. Each response is a file written
+// atomically, so a crash leaves either the whole entry or none of it.
+// Responses are keyed by the file's identity, the exiftool version and the
+// normalized common and request flags. Errors aren't cached. Use Verify to
+// remove entries for files that have changed and Compact to bound the size
+// of the directory.
+type DiskCache struct {
+	extractor Extractor
+	config    DiskCacheConfig
+
+	mu    sync.Mutex
+	stats DiskCacheStats
+}
+
+// diskEntry is the JSON saved for a response
+type diskEntry struct {
+	// Key is compared when reading in case of a hash collision
+	Key string
+
+	// Path, Size, ModTime and Hash describe the file when it was extracted
+	// so Verify can tell if it has changed
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Hash    string `json:",omitempty"`
+
+	Version  string
+	Data     []byte
+	Warnings []Warning `json:",omitempty"`
+
+	// Sum is the SHA-256 of Data to detect corruption
+	Sum string
+}
+
+// NewDiskCache returns a DiskCache in front of e
+func NewDiskCache(e Extractor, config DiskCacheConfig) (*DiskCache, error) {
+	if config.Dir == "" {
+		return nil, errors.New("Cache directory is required")
+	}
+	if config.Version == (Version{}) {
+		return nil, errors.New("Cache needs the exiftool version")
+	}
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "Failed creating cache directory")
+	}
+	return &DiskCache{extractor: e, config: config}, nil
+}
+
+// ExtractWarnings returns the saved response for filename and flags, or
+// gets it from the underlying Extractor and saves it. Failing to save a
+// response isn't an error but is counted in Stats.
+func (c *DiskCache) ExtractWarnings(ctx context.Context, filename string, flags ...string) ([]byte, []Warning, error) {
+	entry, err := c.identify(filename)
+	if err != nil {
+		// let the extractor report why the file can't be read
+		return c.extractor.ExtractWarnings(ctx, filename, flags...)
+	}
+	allFlags := append(c.config.Flags[:len(c.config.Flags):len(c.config.Flags)], flags...)
+	entry.Key = entry.identity() + "\x00" + entry.Version + "\x00" + strings.Join(normalizeFlags(allFlags), "\x00")
+	path := c.entryPath(entry.Key)
+
+	if saved, ok := c.read(path, entry.Key); ok {
+		data := saved.Data
+		if saved.Path != entry.Path {
+			data, ok = restamp(data, filename, entry.Path)
+		}
+		if ok {
+			c.count(&c.stats.Hits)
+			return data, saved.Warnings, nil
+		}
+	}
+	c.count(&c.stats.Misses)
+
+	data, warnings, err := c.extractor.ExtractWarnings(ctx, filename, flags...)
+	if err != nil {
+		return data, warnings, err
+	}
+
+	entry.Data = data
+	entry.Warnings = warnings
+	entry.Sum = sum(data)
+	if err := writeEntry(path, entry); err != nil {
+		c.count(&c.stats.WriteErrors)
+	}
+	return data, warnings, nil
+}
+
+// ExtractMetadata is like ExtractWarnings with -json but parses the output
+func (c *DiskCache) ExtractMetadata(ctx context.Context, filename string, flags ...string) (*Metadata, error) {
+	data, warnings, err := c.ExtractWarnings(ctx, filename, append(flags[:len(flags):len(flags)], "-json")...)
+	if err != nil {
+		return nil, err
+	}
+	return parseSingleMetadata(data, warnings)
+}
+
+// Stats returns how the cache's requests were handled so far
+func (c *DiskCache) Stats() DiskCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+func (c *DiskCache) count(n *int64) {
+	c.mu.Lock()
+	*n++
+	c.mu.Unlock()
+}
+
+// identify describes filename as it is now
+func (c *DiskCache) identify(filename string) (*diskEntry, error) {
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, errors.New("Not a regular file")
+	}
+
+	e := &diskEntry{
+		Path:    path,
+		Size:    info.Size(),
+		ModTime: info.ModTime().UTC(),
+		Version: c.config.Version.String(),
+	}
+	if c.config.HashContents {
+		if e.Hash, err = hashFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// identity is the part of the key that identifies the file
+func (e *diskEntry) identity() string {
+	if e.Hash != "" {
+		return "sha256:" + e.Hash
+	}
+	return fmt.Sprintf("%s\x00%d\x00%d", e.Path, e.Size, e.ModTime.UnixNano())
+}
+
+// entryPath is where the entry for key is stored. Entries are spread over
+// subdirectories so none gets too large.
+func (c *DiskCache) entryPath(key string) string {
+	name := sum([]byte(key))
+	return filepath.Join(c.config.Dir, name[:2], name+".json")
+}
+
+// read loads an entry, removing it if it's corrupt
+func (c *DiskCache) read(path, key string) (*diskEntry, bool) {
+	e, err := readEntry(path)
+	if os.IsNotExist(errors.Cause(err)) {
+		return nil, false
+	}
+	if err != nil {
+		c.count(&c.stats.Corrupt)
+		os.Remove(path)
+		return nil, false
+	}
+	if e.Key != key {
+		return nil, false
+	}
+	return e, true
+}
+
+// restamp changes the SourceFile, FileName, Directory and FilePath tags in
+// a JSON response for another file with the same contents to those of
+// filename, whose absolute path is abs. Only those values are replaced, so
+// the rest of the response keeps exiftool's bytes, key order and duplicate
+// keys. It returns false if data isn't a JSON array of objects.
+func restamp(data []byte, filename, abs string) ([]byte, bool) {
+	// exiftool prints the name it was given, which is the safe one, with
+	// forward slashes
+	safe, err := SafePath(filename)
+	if err != nil {
+		return nil, false
+	}
+	values := map[string]string{
+		"SourceFile": filepath.ToSlash(safe),
+		"FileName":   filepath.Base(safe),
+		"Directory":  filepath.ToSlash(filepath.Dir(safe)),
+		"FilePath":   filepath.ToSlash(abs),
+	}
+
+	var out []byte
+	last := 0
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if t, err := dec.Token(); err != nil || t != json.Delim('[') {
+		return nil, false
+	}
+	for dec.More() {
+		if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+			return nil, false
+		}
+		for dec.More() {
+			t, err := dec.Token()
+			tag, ok := t.(string)
+			if err != nil || !ok {
+				return nil, false
+			}
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return nil, false
+			}
+
+			v, ok := values[tag[strings.LastIndexByte(tag, ':')+1:]]
+			if !ok {
+				continue
+			}
+			value, err := json.Marshal(sourceName(v))
+			if err != nil {
+				return nil, false
+			}
+			// the value ends where the decoder stopped reading it
+			end := int(dec.InputOffset())
+			out = append(append(out, data[last:end-len(raw)]...), value...)
+			last = end
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, false
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, false
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, false
+	}
+	return append(out, data[last:]...), true
+}
+
+func readEntry(path string) (*diskEntry, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	e := &diskEntry{}
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, errors.Wrap(err, "Invalid cache entry")
+	}
+	if e.Key == "" || sum(e.Data) != e.Sum {
+		return nil, errors.New("Corrupt cache entry")
+	}
+	return e, nil
+}
+
+// writeEntry saves e by writing a temporary file and renaming it over path
+// so readers never see part of an entry
+func writeEntry(path string, e *diskEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "Failed encoding cache entry")
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrap(err, "Failed creating cache directory")
+	}
+
+	f, err := ioutil.TempFile(dir, diskTempPrefix)
+	if err != nil {
+		return errors.Wrap(err, "Failed creating cache entry")
+	}
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return errors.Wrap(err, "Failed writing cache entry")
+	}
+	return nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func sum(data []byte) string {
+	s := sha256.Sum256(data)
+	return hex.EncodeToString(s[:])
+}
+
+// VerifyReport counts the entries Verify found. Every entry that isn't
+// valid is removed when pruning.
+type VerifyReport struct {
+	Entries int
+	Valid   int
+
+	// Corrupt entries can't be read
+	Corrupt int
+
+	// Stale entries are for files that have changed or no longer exist.
+	// Entries keyed by the hash of a file's contents are never stale.
+	Stale int
+
+	// Outdated entries are from another version of exiftool
+	Outdated int
+
+	Removed int
+}
+
+// Verify checks every entry can be read, is from the configured version of
+// exiftool and describes its file as it is now. Invalid entries are removed
+// if prune is true.
+func (c *DiskCache) Verify(ctx context.Context, prune bool) (*VerifyReport, error) {
+	report := &VerifyReport{}
+	err := c.walk(ctx, func(path string, info os.FileInfo) error {
+		report.Entries++
+
+		e, err := readEntry(path)
+		switch {
+		case err != nil:
+			report.Corrupt++
+		case e.Version != c.config.Version.String():
+			report.Outdated++
+		case c.stale(e):
+			report.Stale++
+		default:
+			report.Valid++
+			return nil
+		}
+
+		if prune {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return errors.Wrap(err, "Failed removing cache entry")
+			}
+			report.Removed++
+		}
+		return nil
+	})
+	return report, err
+}
+
+// stale returns true if the file e describes has changed. Entries keyed by
+// a hash are used by any file with the same contents, wherever it is, so
+// what happened to the one they were made for doesn't matter.
+func (c *DiskCache) stale(e *diskEntry) bool {
+	if e.Hash != "" {
+		return false
+	}
+	info, err := os.Stat(e.Path)
+	if err != nil {
+		return true
+	}
+	return info.Size() != e.Size || !info.ModTime().Equal(e.ModTime)
+}
+
+// CompactReport counts what Compact removed
+type CompactReport struct {
+	Entries int
+	Bytes   int64
+
+	// Removed and RemovedBytes are the entries removed to fit maxBytes
+	Removed      int
+	RemovedBytes int64
+
+	// TempFiles is the number of partial entries left by crashes that
+	// were removed
+	TempFiles int
+}
+
+// Compact removes temporary files left by crashes and, if maxBytes is more
+// than zero, the oldest entries until the rest take up no more than
+// maxBytes. Empty subdirectories are removed.
+func (c *DiskCache) Compact(ctx context.Context, maxBytes int64) (*CompactReport, error) {
+	report := &CompactReport{}
+
+	type file struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []file
+
+	err := c.walk(ctx, func(path string, info os.FileInfo) error {
+		files = append(files, file{path, info.Size(), info.ModTime()})
+		report.Entries++
+		report.Bytes += info.Size()
+		return nil
+	}, func(path string, info os.FileInfo) error {
+		if time.Since(info.ModTime()) < diskTempAge {
+			return nil
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "Failed removing temporary file")
+		}
+		report.TempFiles++
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	if maxBytes > 0 && report.Bytes > maxBytes {
+		sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+		for _, f := range files {
+			if report.Bytes <= maxBytes {
+				break
+			}
+			if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+				return report, errors.Wrap(err, "Failed removing cache entry")
+			}
+			report.Entries--
+			report.Bytes -= f.size
+			report.Removed++
+			report.RemovedBytes += f.size
+		}
+	}
+
+	// only empty directories can be removed so errors are expected
+	dirs, _ := ioutil.ReadDir(c.config.Dir)
+	for _, d := range dirs {
+		if d.IsDir() {
+			os.Remove(filepath.Join(c.config.Dir, d.Name()))
+		}
+	}
+	return report, nil
+}
+
+// walk calls entry for each entry in the cache and temp, if given, for each
+// temporary file. It stops when ctx is done.
+func (c *DiskCache) walk(ctx context.Context, entry func(string, os.FileInfo) error, temp ...func(string, os.FileInfo) error) error {
+	dirs, err := ioutil.ReadDir(c.config.Dir)
+	if err != nil {
+		return errors.Wrap(err, "Failed reading cache directory")
+	}
+
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+
+		dir := filepath.Join(c.config.Dir, d.Name())
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return errors.Wrap(err, "Failed reading cache directory")
+		}
+
+		for _, f := range files {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			path := filepath.Join(dir, f.Name())
+			switch {
+			case strings.HasPrefix(f.Name(), diskTempPrefix):
+				for _, fn := range temp {
+					if err := fn(path, f); err != nil {
+						return err
+					}
+				}
+			case strings.HasSuffix(f.Name(), ".json"):
+				if err := entry(path, f); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
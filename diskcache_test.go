@@ -0,0 +1,269 @@
+package exiftool
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// diskEntries returns the paths of the entries in a DiskCache directory
+func diskEntries(t *testing.T, dir string) []string {
+	paths, err := filepath.Glob(filepath.Join(dir, "*", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func TestDiskCache(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, files := cacheFiles(t, 1)
+	defer os.RemoveAll(dir)
+	cacheDir := filepath.Join(dir, "cache")
+
+	e := &countingExtractor{}
+	ctx := context.Background()
+	config := DiskCacheConfig{Dir: cacheDir, Version: Version{12, 40}}
+
+	c, err := NewDiskCache(e, config)
+	if !assert.NoError(err) {
+		return
+	}
+	m, err := c.ExtractMetadata(ctx, files[0], "-Make")
+	if assert.NoError(err) {
+		source, _ := m.GetString("SourceFile")
+		assert.Equal(files[0], source)
+	}
+	assert.Len(diskEntries(t, cacheDir), 1)
+
+	// entries survive a restart
+	c, _ = NewDiskCache(e, config)
+	_, err = c.ExtractMetadata(ctx, files[0], "-make")
+	assert.NoError(err)
+	assert.Equal(1, e.count())
+	assert.Equal(DiskCacheStats{Hits: 1}, c.Stats())
+
+	// but not an exiftool upgrade
+	c, _ = NewDiskCache(e, DiskCacheConfig{Dir: cacheDir, Version: Version{12, 41}})
+	_, err = c.ExtractMetadata(ctx, files[0], "-Make")
+	assert.NoError(err)
+	assert.Equal(2, e.count())
+
+	// a corrupt entry is a miss and is replaced
+	for _, path := range diskEntries(t, cacheDir) {
+		assert.NoError(ioutil.WriteFile(path, []byte(`{"Key": "trunc`), 0644))
+	}
+	c, _ = NewDiskCache(e, config)
+	_, err = c.ExtractMetadata(ctx, files[0], "-Make")
+	assert.NoError(err)
+	_, err = c.ExtractMetadata(ctx, files[0], "-Make")
+	assert.NoError(err)
+	assert.Equal(3, e.count())
+	assert.Equal(DiskCacheStats{Hits: 1, Misses: 1, Corrupt: 1}, c.Stats())
+
+	_, err = NewDiskCache(e, DiskCacheConfig{Dir: cacheDir})
+	assert.Error(err)
+}
+
+func TestDiskCacheHashContents(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, files := cacheFiles(t, 2)
+	defer os.RemoveAll(dir)
+	cacheDir := filepath.Join(dir, "cache")
+
+	e := &countingExtractor{}
+	ctx := context.Background()
+	c, err := NewDiskCache(e, DiskCacheConfig{Dir: cacheDir, Version: Version{12, 40}, HashContents: true})
+	if !assert.NoError(err) {
+		return
+	}
+
+	c.ExtractMetadata(ctx, files[0])
+
+	// touching a file or copying it doesn't change its contents, but the
+	// copy gets its own path
+	later := time.Now().Add(time.Hour)
+	assert.NoError(os.Chtimes(files[0], later, later))
+	c.ExtractMetadata(ctx, files[0])
+	m, err := c.ExtractMetadata(ctx, files[1])
+	if assert.NoError(err) {
+		source, _ := m.GetString("SourceFile")
+		assert.Equal(files[1], source)
+	}
+	assert.Equal(1, e.count())
+
+	// entries of files that moved are kept
+	moved := filepath.Join(dir, "moved.jpg")
+	assert.NoError(os.Rename(files[0], moved))
+	report, err := c.Verify(ctx, true)
+	if assert.NoError(err) {
+		assert.Equal(&VerifyReport{Entries: 1, Valid: 1}, report)
+	}
+	m, err = c.ExtractMetadata(ctx, moved)
+	if assert.NoError(err) {
+		source, _ := m.GetString("SourceFile")
+		assert.Equal(moved, source)
+	}
+	assert.Equal(1, e.count())
+
+	assert.NoError(ioutil.WriteFile(moved, []byte("changed"), 0644))
+	c.ExtractMetadata(ctx, moved)
+	assert.Equal(2, e.count())
+}
+
+func TestDiskCacheFlags(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, files := cacheFiles(t, 1)
+	defer os.RemoveAll(dir)
+	cacheDir := filepath.Join(dir, "cache")
+
+	e := &countingExtractor{}
+	ctx := context.Background()
+	// -g is also a request flag and -G is a different option
+	for _, flags := range [][]string{nil, {"-n"}, {"-G"}, {"-g"}, {"-n", "-g"}} {
+		c, _ := NewDiskCache(e, DiskCacheConfig{Dir: cacheDir, Version: Version{12, 40}, Flags: flags})
+		c.ExtractWarnings(ctx, files[0], "-g")
+	}
+	assert.Equal(3, e.count())
+}
+
+func TestRestamp(t *testing.T) {
+	assert := assert.New(t)
+
+	// everything but the path values is kept as exiftool printed it
+	data := []byte(`[{
+  "SourceFile": "a/1.jpg",
+  "System:FileName": "1.jpg",
+  "File:Directory": "a",
+  "FilePath": "/x/a/1.jpg",
+  "Make": "Canon",
+  "Comment": "<b>&amp;</b>",
+  "Comment": "again",
+  "Size": 12.50,
+  "Lens": {"Model": "EF", "FileName": "kept"}
+}]
+`)
+	want := `[{
+  "SourceFile": "./-2.jpg",
+  "System:FileName": "-2.jpg",
+  "File:Directory": ".",
+  "FilePath": "/x/-2.jpg",
+  "Make": "Canon",
+  "Comment": "<b>&amp;</b>",
+  "Comment": "again",
+  "Size": 12.50,
+  "Lens": {"Model": "EF", "FileName": "kept"}
+}]
+`
+	got, ok := restamp(data, "-2.jpg", "/x/-2.jpg")
+	if assert.True(ok) {
+		assert.Equal(want, string(got))
+	}
+
+	for _, bad := range []string{"binary", `{"SourceFile": "a"}`, `[{"SourceFile": "a"}`, `[{"a": 1}] x`, `[1]`} {
+		_, ok = restamp([]byte(bad), "2.jpg", "/x/2.jpg")
+		assert.False(ok, bad)
+	}
+}
+
+func TestDiskCacheVerify(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, files := cacheFiles(t, 4)
+	defer os.RemoveAll(dir)
+	cacheDir := filepath.Join(dir, "cache")
+
+	e := &countingExtractor{}
+	ctx := context.Background()
+	c, _ := NewDiskCache(e, DiskCacheConfig{Dir: cacheDir, Version: Version{12, 40}})
+	for _, f := range files[:3] {
+		c.ExtractWarnings(ctx, f)
+	}
+	old, _ := NewDiskCache(e, DiskCacheConfig{Dir: cacheDir, Version: Version{11, 0}})
+	old.ExtractWarnings(ctx, files[3])
+
+	// files[0] changes and files[1] is deleted
+	assert.NoError(ioutil.WriteFile(files[0], []byte("changed"), 0644))
+	assert.NoError(os.Remove(files[1]))
+
+	report, err := c.Verify(ctx, false)
+	if assert.NoError(err) {
+		assert.Equal(&VerifyReport{Entries: 4, Valid: 1, Stale: 2, Outdated: 1}, report)
+	}
+	assert.Len(diskEntries(t, cacheDir), 4)
+
+	report, err = c.Verify(ctx, true)
+	if assert.NoError(err) {
+		assert.Equal(3, report.Removed)
+	}
+	assert.Len(diskEntries(t, cacheDir), 1)
+
+	report, err = c.Verify(ctx, false)
+	if assert.NoError(err) {
+		assert.Equal(&VerifyReport{Entries: 1, Valid: 1}, report)
+	}
+}
+
+func TestDiskCacheCompact(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, files := cacheFiles(t, 4)
+	defer os.RemoveAll(dir)
+	cacheDir := filepath.Join(dir, "cache")
+
+	e := &countingExtractor{}
+	ctx := context.Background()
+	c, _ := NewDiskCache(e, DiskCacheConfig{Dir: cacheDir, Version: Version{12, 40}})
+
+	// entries are removed oldest first
+	start := time.Now().Add(-time.Hour)
+	for i, f := range files {
+		c.ExtractWarnings(ctx, f)
+		paths := diskEntries(t, cacheDir)
+		for _, p := range paths {
+			if info, _ := os.Stat(p); time.Since(info.ModTime()) < time.Minute {
+				when := start.Add(time.Duration(i) * time.Minute)
+				os.Chtimes(p, when, when)
+			}
+		}
+	}
+
+	// a partial entry left by a crash, and one being written
+	paths := diskEntries(t, cacheDir)
+	crashed := filepath.Join(filepath.Dir(paths[0]), diskTempPrefix+"crashed")
+	writing := filepath.Join(filepath.Dir(paths[0]), diskTempPrefix+"writing")
+	assert.NoError(ioutil.WriteFile(crashed, []byte("{"), 0644))
+	assert.NoError(ioutil.WriteFile(writing, []byte("{"), 0644))
+	assert.NoError(os.Chtimes(crashed, start, start))
+
+	report, err := c.Compact(ctx, 0)
+	if assert.NoError(err) {
+		assert.Equal(4, report.Entries)
+		assert.Equal(1, report.TempFiles)
+		assert.Equal(0, report.Removed)
+	}
+	_, err = os.Stat(writing)
+	assert.NoError(err)
+
+	size := report.Bytes / 4
+	report, err = c.Compact(ctx, size*2+size/2)
+	if assert.NoError(err) {
+		assert.Equal(2, report.Entries)
+		assert.Equal(2, report.Removed)
+	}
+
+	// the newest entries are kept
+	c.ExtractWarnings(ctx, files[3])
+	c.ExtractWarnings(ctx, files[2])
+	assert.Equal(4, e.count())
+	c.ExtractWarnings(ctx, files[0])
+	assert.Equal(5, e.count())
+}
@@ -0,0 +1,125 @@
+package exiftool
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrFileNotFound is the cause of an *Error when exiftool could not
+	// find the requested file
+	ErrFileNotFound = errors.New("File not found")
+
+	// ErrUnknownFileType is the cause of an *Error when exiftool does not
+	// recognize the type of the file
+	ErrUnknownFileType = errors.New("Unknown file type")
+
+	// ErrPermissionDenied is the cause of an *Error when exiftool was not
+	// allowed to open the file
+	ErrPermissionDenied = errors.New("Permission denied")
+
+	// ErrResponseTooLarge is returned when the output for a request is
+	// larger than the Stayopen's MaxResponseSize
+	ErrResponseTooLarge = errors.New("Response too large")
+
+	// ErrExiftool is the cause of an *Error that doesn't fit any of the
+	// more specific errors
+	ErrExiftool = errors.New("exiftool error")
+
+	// ErrStopped is returned by a Stayopen or Pool that has been closed or
+	// stopped
+	ErrStopped = errors.New("Stopped")
+)
+
+// Errors holds the errors from shutting down several exiftool processes
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Error is an error message exiftool printed to stderr. Use errors.Cause
+// to compare it to ErrFileNotFound, ErrUnknownFileType, ErrPermissionDenied
+// or ErrExiftool.
+type Error struct {
+	Err     error
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Cause supports github.com/pkg/errors.Cause
+func (e *Error) Cause() error {
+	return e.Err
+}
+
+// Unwrap supports errors.Is from the standard library
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Warning is a non-fatal message exiftool printed to stderr
+type Warning struct {
+	Message string
+
+	// Minor is true for warnings exiftool tags with [minor]. These can
+	// be ignored with the -m flag.
+	Minor bool
+}
+
+func (w Warning) String() string {
+	if w.Minor {
+		return "[minor] " + w.Message
+	}
+	return w.Message
+}
+
+// parseStderr turns exiftool's stderr output into a list of warnings and
+// the first error it reported
+func parseStderr(stderr []byte) ([]Warning, error) {
+	var err error
+	var warnings []Warning
+
+	scanner := bufio.NewScanner(bytes.NewReader(stderr))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "Error: "):
+			if err == nil {
+				err = newError(strings.TrimPrefix(line, "Error: "))
+			}
+		case strings.HasPrefix(line, "Warning: "):
+			msg := strings.TrimPrefix(line, "Warning: ")
+			minor := strings.HasPrefix(msg, "[minor] ")
+			warnings = append(warnings, Warning{
+				Message: strings.TrimPrefix(msg, "[minor] "),
+				Minor:   minor,
+			})
+		}
+	}
+
+	return warnings, err
+}
+
+func newError(msg string) *Error {
+	e := &Error{Err: ErrExiftool, Message: msg}
+	switch {
+	case strings.HasPrefix(msg, "File not found"):
+		e.Err = ErrFileNotFound
+	case strings.HasPrefix(msg, "Unknown file type"):
+		e.Err = ErrUnknownFileType
+	case strings.Contains(msg, "Permission denied"),
+		strings.HasPrefix(msg, "Error opening file"):
+		e.Err = ErrPermissionDenied
+	}
+	return e
+}
@@ -0,0 +1,50 @@
+package exiftool
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStderr(t *testing.T) {
+	assert := assert.New(t)
+
+	stderr := []byte("Warning: [minor] Unrecognized MakerNotes - a.jpg\n" +
+		"Warning: Bad IFD0 directory - a.jpg\n" +
+		"Error: File not found - a.jpg\n" +
+		"Error: Unknown file type - a.jpg\n")
+
+	warnings, err := parseStderr(stderr)
+	if assert.Error(err) {
+		assert.Equal(ErrFileNotFound, errors.Cause(err))
+		assert.Equal("File not found - a.jpg", err.Error())
+	}
+
+	assert.Equal([]Warning{
+		{Message: "Unrecognized MakerNotes - a.jpg", Minor: true},
+		{Message: "Bad IFD0 directory - a.jpg"},
+	}, warnings)
+}
+
+func TestParseStderrKinds(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := map[string]error{
+		"Error: File not found - a.jpg\n":                  ErrFileNotFound,
+		"Error: Unknown file type - a.txt\n":               ErrUnknownFileType,
+		"Error: Error opening file - a.jpg\n":              ErrPermissionDenied,
+		"Error: Permission denied - a.jpg\r\n":             ErrPermissionDenied,
+		"Error: File format error - a.jpg\n":               ErrExiftool,
+		"    1 image files read\nError: Not a JPEG file\n": ErrExiftool,
+	}
+
+	for stderr, expected := range tests {
+		_, err := parseStderr([]byte(stderr))
+		assert.Equal(expected, errors.Cause(err), stderr)
+	}
+
+	warnings, err := parseStderr(nil)
+	assert.NoError(err)
+	assert.Len(warnings, 0)
+}
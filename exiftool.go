@@ -4,70 +4,132 @@ package exiftool
 
 import (
 	"bytes"
+	"context"
 	"io"
+	"io/ioutil"
+	"os"
 	"os/exec"
-	"strconv"
 
 	"github.com/pkg/errors"
 )
 
-var ErrFilenameInvalid = errors.New("Filename contains control characters")
+// ErrFilenameInvalid is the cause of an *ArgError for a filename that
+// can't be passed to exiftool
+var ErrFilenameInvalid = errors.New("Invalid filename")
 
 // Extract calls a specific exiftool with specific CLI flags
 func Extract(exiftool, filename string, flags ...string) ([]byte, error) {
+	return ExtractContext(context.Background(), exiftool, filename, flags...)
+}
 
-	if !strconv.CanBackquote(filename) {
-		return nil, ErrFilenameInvalid
+// ExtractContext is like Extract but kills the exiftool process and returns
+// ctx.Err() if the context is done before exiftool exits
+func ExtractContext(ctx context.Context, exiftool, filename string, flags ...string) ([]byte, error) {
+	args, err := readArgs(flags, nil, filename)
+	if err != nil {
+		return nil, err
 	}
 
-	flags = append(flags, filename)
-	cmd := exec.Command(exiftool, flags...)
-	var stdout, stderr bytes.Buffer
+	data, _, err := run(ctx, exiftool, nil, args)
+	return data, err
+}
 
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+// ExtractReader extracts EXIF/metadata from an io.Reader, passing data to
+// exiftool via stdin
+func ExtractReader(exiftool string, source io.Reader, flags ...string) ([]byte, error) {
+	return ExtractReaderContext(context.Background(), exiftool, source, flags...)
+}
 
-	err := cmd.Run()
+// ExtractReaderContext is like ExtractReader but kills the exiftool process
+// and returns ctx.Err() if the context is done before exiftool exits
+func ExtractReaderContext(ctx context.Context, exiftool string, source io.Reader, flags ...string) ([]byte, error) {
+	if err := CheckFlags(flags); err != nil {
+		return nil, err
+	}
+
+	data, _, err := run(ctx, exiftool, source, append(flags[:len(flags):len(flags)], "-"))
+	return data, err
+}
+
+// run calls exiftool once with args and returns what it printed to stdout
+// along with any warnings from stderr and the *Error for an error message
+func run(ctx context.Context, exiftool string, stdin io.Reader, args []string) ([]byte, []Warning, error) {
+	stdout, stderr, err := runOutput(ctx, exiftool, stdin, args)
+	if ctx.Err() != nil {
+		return nil, nil, ctx.Err()
+	}
 
-	// exiftool will exit and print valid output to stdout
-	// if it exits with an unrecognized filetype, don't process
-	// that situtation here
-	if err != nil && stdout.Len() == 0 {
-		return nil, errors.Errorf("%s", stderr.String())
+	// exiftool can print output for a file it reported an error for, like
+	// the SourceFile and Error tags of an unknown file type, which is
+	// returned with the error
+	warnings, exifErr := parseStderr(stderr)
+	if exifErr != nil {
+		return stdout, warnings, exifErr
 	}
 
-	// no exit error but also no output
-	if stdout.Len() == 0 {
-		return nil, errors.New("No output")
+	if len(stdout) == 0 {
+		if err != nil {
+			return nil, nil, errors.Errorf("%s", stderr)
+		}
+
+		// no exit error but also no output
+		return nil, nil, errors.New("No output")
 	}
 
-	return stdout.Bytes(), nil
+	return stdout, warnings, nil
 }
 
-// ExtractReader extracts EXIF/metadata from an io.Reader, passing data to
-// exiftool via stdin
-func ExtractReader(exiftool string, source io.Reader, flags ...string) ([]byte, error) {
-	flags = append(flags, "-")
-	cmd := exec.Command(exiftool, flags...)
+// runOutput calls exiftool once with args and returns everything it printed
+func runOutput(ctx context.Context, exiftool string, stdin io.Reader, args []string) ([]byte, []byte, error) {
+	cmd := exec.CommandContext(ctx, exiftool, args...)
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
-	cmd.Stdin = source
+	cmd.Stdin = stdin
 
 	err := cmd.Run()
+	return stdout.Bytes(), stderr.Bytes(), err
+}
+
+// spool copies source to a new temporary file in dir, or the default
+// directory for temporary files if dir is empty, so exiftool can read it by
+// name. It gives up with ctx.Err() if ctx is done between reads of source.
+// The caller removes the file.
+func spool(ctx context.Context, dir string, source io.Reader) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 
-	// exiftool will exit and print valid output to stdout
-	// if it exits with an unrecognized filetype, don't process
-	// that situtation here
-	if err != nil && stdout.Len() == 0 {
-		return nil, errors.Errorf("%s", stderr.String())
+	f, err := ioutil.TempFile(dir, "go-exiftool")
+	if err != nil {
+		return "", errors.Wrap(err, "Failed creating temporary file")
 	}
 
-	// no exit error but also no output
-	if stdout.Len() == 0 {
-		return nil, errors.New("No output")
+	_, err = io.Copy(f, &contextReader{ctx, source})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", errors.Wrap(err, "Failed writing temporary file")
 	}
 
-	return stdout.Bytes(), nil
+	return f.Name(), nil
+}
+
+// contextReader fails reads once ctx is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
 }
@@ -1,10 +1,12 @@
 package exiftool
 
 import (
+	"context"
 	"os"
 	"testing"
 
 	"github.com/buger/jsonparser"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -31,6 +33,18 @@ func TestExtractDateFormat(t *testing.T) {
 	}
 }
 
+func TestExtractContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := ExtractContext(ctx, "exiftool", "testdata/IMG_7238.JPG", "-j")
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestExtractFileNotFound(t *testing.T) {
+	_, err := Extract("exiftool", "testdata/does-not-exist.jpg", "-j")
+	assert.Equal(t, ErrFileNotFound, errors.Cause(err))
+}
+
 func testExtractReaderFlags(t *testing.T) {
 	assert := assert.New(t)
 	f, err := os.Open("testdata/IMG_7238.JPG")
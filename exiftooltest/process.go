@@ -0,0 +1,105 @@
+package exiftooltest
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	exiftool "github.com/mostlygeek/go-exiftool"
+	"github.com/pkg/errors"
+)
+
+// ErrKilled is returned by Wait for a fake that was killed or signalled
+var ErrKilled = errors.New("Killed")
+
+// Start runs a fake in memory, connected to the returned Process with
+// pipes. It is an exiftool.Starter and ignores the exiftool path.
+func (s *Server) Start(_ string, args ...string) (exiftool.Process, error) {
+	p := &process{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	p.stdinR, p.stdin = io.Pipe()
+	p.stdout, p.stdoutW = io.Pipe()
+	p.stderr, p.stderrW = io.Pipe()
+
+	go func() {
+		status := s.run(args, p.stdinR, p.stdoutW, p.stderrW, p.stop)
+		p.stdinR.Close()
+		p.stdoutW.Close()
+		p.stderrW.Close()
+
+		p.mu.Lock()
+		p.status = status
+		p.mu.Unlock()
+		close(p.done)
+	}()
+
+	return p, nil
+}
+
+// process is a fake running in a goroutine
+type process struct {
+	stdin   *io.PipeWriter
+	stdinR  *io.PipeReader
+	stdout  *io.PipeReader
+	stdoutW *io.PipeWriter
+	stderr  *io.PipeReader
+	stderrW *io.PipeWriter
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+
+	mu     sync.Mutex
+	status int
+	killed bool
+}
+
+func (p *process) Stdin() io.WriteCloser { return p.stdin }
+func (p *process) Stdout() io.Reader     { return p.stdout }
+func (p *process) Stderr() io.Reader     { return p.stderr }
+
+// Signal stops the fake whatever the signal is
+func (p *process) Signal(sig os.Signal) error {
+	return p.Kill()
+}
+
+// Kill stops the fake, interrupting any delay and closing its pipes so it
+// can't block reading or writing them. Killing a fake that has exited does
+// nothing.
+func (p *process) Kill() error {
+	p.stopOnce.Do(func() {
+		select {
+		case <-p.done:
+			return
+		default:
+		}
+
+		p.mu.Lock()
+		p.killed = true
+		p.mu.Unlock()
+
+		close(p.stop)
+		p.stdinR.Close()
+		p.stdoutW.Close()
+		p.stderrW.Close()
+	})
+	return nil
+}
+
+func (p *process) Wait() error {
+	<-p.done
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case p.killed:
+		return ErrKilled
+	case p.status != 0:
+		return fmt.Errorf("exit status %d", p.status)
+	}
+	return nil
+}
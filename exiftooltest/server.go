@@ -0,0 +1,313 @@
+// Package exiftooltest provides a scriptable fake exiftool for testing code
+// that uses go-exiftool without installing exiftool.
+//
+// A Server can run in memory as the Starter of a Stayopen or Pool:
+//
+//	s := &exiftooltest.Server{Responses: map[string]exiftooltest.Response{
+//		"a.jpg": {Tags: map[string]interface{}{"Make": "Apple"}},
+//	}}
+//	stayopen, err := exiftool.NewStayOpenStarter(s.Start, "exiftool")
+//
+// or as a separate process, for the one-shot functions and for testing how
+// real processes are handled, by saving it as a script and running the
+// cmd/fake-exiftool command, or any binary that calls Main, with EnvScript
+// set to the script's path.
+package exiftooltest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	exiftool "github.com/mostlygeek/go-exiftool"
+	"github.com/pkg/errors"
+)
+
+// EnvScript is the environment variable Main reads the path of the script
+// to run from
+const EnvScript = "EXIFTOOLTEST_SCRIPT"
+
+// DefaultVersion is printed for -ver when a Server has no Version
+const DefaultVersion = "12.40"
+
+// crashStatus is the exit status of a fake that crashed
+const crashStatus = 3
+
+// Response scripts how the fake handles one file
+type Response struct {
+	// Tags are printed for the file, as JSON with -json and as `Tag: value`
+	// lines otherwise. SourceFile is added. When tags are given on the
+	// command line, like -Make, only those are printed.
+	Tags map[string]interface{} `json:",omitempty"`
+
+	// Stdout is printed instead of Tags when it isn't empty, which can be
+	// used to return oversized or malformed output
+	Stdout string `json:",omitempty"`
+
+	// Stderr is printed to stderr, for example "Warning: Bad IFD" or
+	// "Error: File format error"
+	Stderr string `json:",omitempty"`
+
+	// Delay is how long the fake waits before handling the file
+	Delay time.Duration `json:",omitempty"`
+
+	// Crash makes the fake exit without responding
+	Crash bool `json:",omitempty"`
+}
+
+// Server is a fake exiftool that understands enough of exiftool's command
+// line, including -stay_open, to be used in its place. A Server may run
+// any number of fakes at once but must not be modified while they run.
+type Server struct {
+	// Responses are keyed by filename as it appears on the command line
+	Responses map[string]Response
+
+	// Default is used for files that aren't in Responses. When it is nil
+	// the fake reports those files as not found.
+	Default *Response `json:",omitempty"`
+
+	// Version is printed for -ver. DefaultVersion is used when empty.
+	Version string `json:",omitempty"`
+
+	mu        sync.Mutex
+	requested []string
+}
+
+// LoadScript reads a Server saved with WriteScript
+func LoadScript(filename string) (*Server, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed reading script")
+	}
+
+	s := &Server{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, errors.Wrap(err, "Failed parsing script")
+	}
+	return s, nil
+}
+
+// WriteScript saves the server's responses as JSON so a fake can be run as
+// a separate process
+func (s *Server) WriteScript(filename string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return errors.Wrap(err, "Failed encoding script")
+	}
+	return errors.Wrap(ioutil.WriteFile(filename, data, 0644), "Failed writing script")
+}
+
+// Main runs the fake scripted by the file named in EnvScript with the
+// process's arguments and standard streams, then exits
+func Main() {
+	s, err := LoadScript(os.Getenv(EnvScript))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	os.Exit(s.Run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// Requested returns the files the fakes were asked about, in order. Files
+// requested by a fake running in a separate process aren't included.
+func (s *Server) Requested() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requested...)
+}
+
+// Run handles exiftool's command line args, reading further requests from
+// stdin in stay_open mode, and returns the exit status
+func (s *Server) Run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	return s.run(args, stdin, stdout, stderr, nil)
+}
+
+// run is Run but returns crashStatus early once stop is closed
+func (s *Server) run(args []string, stdin io.Reader, stdout, stderr io.Writer, stop chan struct{}) int {
+	if len(args) < 4 || args[0] != "-stay_open" || !strings.EqualFold(args[1], "true") {
+		return s.execute(args, stdout, stderr, stop)
+	}
+
+	var common []string
+	for i, a := range args {
+		if a == "-common_args" {
+			common = args[i+1:]
+			break
+		}
+	}
+
+	var req []string
+	scanner := bufio.NewScanner(stdin)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line, ok := exiftool.DecodeArg(scanner.Text())
+		if !ok {
+			continue
+		}
+		if !strings.HasPrefix(line, "-execute") {
+			req = append(req, line)
+			continue
+		}
+
+		if len(req) >= 2 && req[0] == "-stay_open" && strings.EqualFold(req[1], "false") {
+			return 0
+		}
+
+		// stdout is written once the request is done, like exiftool's JSON
+		// output, but stderr as it goes, like its messages. A caller that
+		// doesn't read both at once blocks the fake as it would exiftool.
+		var out bytes.Buffer
+		if status := s.execute(append(req, common...), &out, stderr, stop); status == crashStatus {
+			return status
+		}
+		fmt.Fprintf(&out, "{ready%s}\n", strings.TrimPrefix(line, "-execute"))
+		stdout.Write(out.Bytes())
+		req = nil
+	}
+	return 0
+}
+
+// valueFlags are the options that take the next argument as their value
+var valueFlags = map[string]bool{
+	"-@": true, "-api": true, "-charset": true, "-d": true, "-dateFormat": true,
+	"-echo": true, "-echo1": true, "-echo2": true, "-echo3": true, "-echo4": true,
+	"-o": true, "-p": true, "-sep": true, "-stay_open": true, "-tagsFromFile": true,
+	"-w": true,
+}
+
+// execute handles a single request and returns the exit status
+func (s *Server) execute(args []string, stdout, stderr io.Writer, stop chan struct{}) int {
+	var files, selected, echo3, echo4 []string
+	jsonOutput := false
+
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case valueFlags[a] && i+1 < len(args):
+			i++
+			switch a {
+			case "-echo3":
+				echo3 = append(echo3, args[i])
+			case "-echo4":
+				echo4 = append(echo4, args[i])
+			}
+		case a == "-ver":
+			version := s.Version
+			if version == "" {
+				version = DefaultVersion
+			}
+			fmt.Fprintln(stdout, version)
+			return 0
+		case a == "-j" || a == "-json":
+			jsonOutput = true
+		case len(a) > 1 && a[0] == '-' && a[1] >= 'A' && a[1] <= 'Z' && !strings.Contains(a, "="):
+			selected = append(selected, a[1:])
+		case len(a) > 1 && a[0] == '-':
+			// other options don't change the fake's output
+		default:
+			files = append(files, a)
+		}
+	}
+
+	s.mu.Lock()
+	s.requested = append(s.requested, files...)
+	s.mu.Unlock()
+
+	status := 0
+	var out []map[string]interface{}
+	for _, f := range files {
+		r, ok := s.Responses[f]
+		if !ok && s.Default != nil {
+			r, ok = *s.Default, true
+		}
+		if !ok {
+			fmt.Fprintf(stderr, "Error: File not found - %s\n", f)
+			status = 1
+			continue
+		}
+
+		if r.Delay > 0 {
+			select {
+			case <-time.After(r.Delay):
+			case <-stop:
+				return crashStatus
+			}
+		}
+		if r.Crash {
+			return crashStatus
+		}
+
+		if r.Stderr != "" {
+			fmt.Fprint(stderr, r.Stderr)
+			if !strings.HasSuffix(r.Stderr, "\n") {
+				fmt.Fprintln(stderr)
+			}
+		}
+
+		if r.Stdout != "" {
+			io.WriteString(stdout, r.Stdout)
+			continue
+		}
+
+		tags := map[string]interface{}{"SourceFile": f}
+		for k, v := range r.Tags {
+			if len(selected) == 0 || contains(selected, k) {
+				tags[k] = v
+			}
+		}
+
+		if jsonOutput {
+			out = append(out, tags)
+			continue
+		}
+		if len(files) > 1 {
+			fmt.Fprintf(stdout, "======== %s\n", f)
+		}
+		printTags(stdout, tags)
+	}
+
+	if len(out) > 0 {
+		data, _ := json.MarshalIndent(out, "", "  ")
+		fmt.Fprintf(stdout, "%s\n", data)
+	}
+
+	for _, e := range echo3 {
+		fmt.Fprintln(stdout, e)
+	}
+	for _, e := range echo4 {
+		fmt.Fprintln(stderr, e)
+	}
+	return status
+}
+
+// printTags prints tags in exiftool's default format, without SourceFile
+func printTags(w io.Writer, tags map[string]interface{}) {
+	names := make([]string, 0, len(tags))
+	for k := range tags {
+		if k != "SourceFile" {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+
+	for _, k := range names {
+		fmt.Fprintf(w, "%-32s: %v\n", k, tags[k])
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,281 @@
+package exiftooltest
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	exiftool "github.com/mostlygeek/go-exiftool"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMain lets the test binary act as a fake exiftool for TestBinary
+func TestMain(m *testing.M) {
+	if os.Getenv(EnvScript) != "" {
+		Main()
+	}
+	os.Exit(m.Run())
+}
+
+func newServer() *Server {
+	return &Server{
+		Responses: map[string]Response{
+			"a.jpg":     {Tags: map[string]interface{}{"Make": "Apple", "ISO": 25}},
+			"warn.jpg":  {Tags: map[string]interface{}{"Make": "Canon"}, Stderr: "Warning: Bad IFD"},
+			"slow.jpg":  {Tags: map[string]interface{}{"Make": "Nikon"}, Delay: 2 * time.Second},
+			"crash.jpg": {Crash: true},
+			"big.jpg":   {Stdout: strings.Repeat("x", 100000)},
+			"unknown.txt": {
+				Stdout: `[{"SourceFile": "unknown.txt", "Error": "Unknown file type"}]`,
+				Stderr: "Warning: Odd name\nError: Unknown file type - unknown.txt",
+			},
+		},
+	}
+}
+
+func TestServer(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newServer()
+	stayopen, err := exiftool.NewStayOpenStarter(s.Start, "exiftool")
+	if !assert.NoError(err) {
+		return
+	}
+	defer stayopen.Stop()
+
+	ctx := context.Background()
+
+	m, err := stayopen.ExtractMetadata(ctx, "a.jpg")
+	if assert.NoError(err) {
+		mk, _ := m.GetString("Make")
+		assert.Equal("Apple", mk)
+		iso, _ := m.GetInt("ISO")
+		assert.Equal(int64(25), iso)
+	}
+
+	// tags on the command line select what is printed
+	m, err = stayopen.ExtractMetadata(ctx, "a.jpg", "-ISO")
+	if assert.NoError(err) {
+		assert.Equal([]string{"ISO", "SourceFile"}, m.Tags())
+	}
+
+	m, err = stayopen.ExtractMetadata(ctx, "warn.jpg")
+	if assert.NoError(err) {
+		assert.Equal([]exiftool.Warning{{Message: "Bad IFD"}}, m.Warnings)
+	}
+
+	_, err = stayopen.ExtractMetadata(ctx, "missing.jpg")
+	assert.Equal(exiftool.ErrFileNotFound, errors.Cause(err))
+
+	assert.Equal([]string{"a.jpg", "a.jpg", "warn.jpg", "missing.jpg"}, s.Requested())
+}
+
+func TestServerDelay(t *testing.T) {
+	assert := assert.New(t)
+
+	stayopen, err := exiftool.NewStayOpenStarter(newServer().Start, "exiftool", "-json")
+	if !assert.NoError(err) {
+		return
+	}
+	defer stayopen.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err = stayopen.ExtractFlagsContext(ctx, "slow.jpg")
+	assert.Equal(context.DeadlineExceeded, err)
+
+	// the fake was replaced and the next request gets its own response
+	_, err = stayopen.ExtractMetadata(context.Background(), "a.jpg")
+	assert.NoError(err)
+}
+
+func TestServerCrash(t *testing.T) {
+	assert := assert.New(t)
+
+	stayopen, err := exiftool.NewStayOpenStarter(newServer().Start, "exiftool")
+	if !assert.NoError(err) {
+		return
+	}
+	defer stayopen.Stop()
+	stayopen.MaxRetries = 1
+
+	_, err = stayopen.ExtractMetadata(context.Background(), "crash.jpg")
+	assert.Error(err)
+	assert.Equal(2, stayopen.Restarts())
+
+	_, err = stayopen.ExtractMetadata(context.Background(), "a.jpg")
+	assert.NoError(err)
+}
+
+func TestServerOversized(t *testing.T) {
+	assert := assert.New(t)
+
+	stayopen, err := exiftool.NewStayOpenStarter(newServer().Start, "exiftool")
+	if !assert.NoError(err) {
+		return
+	}
+	defer stayopen.Stop()
+	stayopen.MaxResponseSize = 1000
+
+	_, err = stayopen.ExtractFlags("big.jpg")
+	assert.Equal(exiftool.ErrResponseTooLarge, err)
+
+	_, err = stayopen.ExtractMetadata(context.Background(), "a.jpg")
+	assert.NoError(err)
+}
+
+func TestServerForgedReadyToken(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &Server{
+		Responses: map[string]Response{
+			"stale.jpg":  {Tags: map[string]interface{}{"Comment": "{ready1}"}},
+			"future.jpg": {Tags: map[string]interface{}{"Comment": "{ready99}"}},
+			"line.jpg":   {Stdout: "before\n{ready3}\n{ready1003}\nafter\n"},
+		},
+	}
+	stayopen, err := exiftool.NewStayOpenStarter(s.Start, "exiftool")
+	if !assert.NoError(err) {
+		return
+	}
+	defer stayopen.Stop()
+
+	// the tokens in the output are returned rather than ending the response
+	for name, want := range map[string]string{
+		"stale.jpg":  "{ready1}\n",
+		"future.jpg": "{ready99}\n",
+		"line.jpg":   "before\n{ready3}\n{ready1003}\nafter\n",
+	} {
+		data, err := stayopen.Extract(name)
+		if assert.NoError(err, name) {
+			assert.True(strings.HasSuffix(string(data), want), "%s: %q", name, data)
+		}
+	}
+
+	data, err := stayopen.Extract("stale.jpg")
+	assert.NoError(err)
+	assert.Contains(string(data), "{ready1}")
+	assert.Equal(0, stayopen.Restarts())
+}
+
+func TestServerPool(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newServer()
+	pool, err := exiftool.NewPoolConfig(exiftool.PoolConfig{Size: 2, Starter: s.Start})
+	if !assert.NoError(err) {
+		return
+	}
+	defer pool.Stop()
+
+	var e exiftool.Extractor = pool
+	m, err := e.ExtractMetadata(context.Background(), "a.jpg")
+	if assert.NoError(err) {
+		mk, _ := m.GetString("Make")
+		assert.Equal("Apple", mk)
+	}
+}
+
+// TestBinary runs the test binary as a fake exiftool in a separate process
+func TestBinary(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "exiftooltest")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	script := filepath.Join(dir, "script.json")
+	if !assert.NoError(newServer().WriteScript(script)) {
+		return
+	}
+
+	os.Setenv(EnvScript, script)
+	defer os.Unsetenv(EnvScript)
+
+	stayopen, err := exiftool.NewStayOpen(os.Args[0])
+	if !assert.NoError(err) {
+		return
+	}
+	defer stayopen.Stop()
+
+	ctx := context.Background()
+	for _, e := range []exiftool.Extractor{exiftool.Command(os.Args[0]), stayopen} {
+		m, err := e.ExtractMetadata(ctx, "a.jpg")
+		if assert.NoError(err) {
+			mk, _ := m.GetString("Make")
+			assert.Equal("Apple", mk)
+		}
+
+		_, warnings, err := e.ExtractWarnings(ctx, "warn.jpg", "-json")
+		assert.NoError(err)
+		assert.Len(warnings, 1)
+
+		_, err = e.ExtractMetadata(ctx, "missing.jpg")
+		assert.Equal(exiftool.ErrFileNotFound, errors.Cause(err))
+
+		// output printed with an error is returned with it
+		data, warnings, err := e.ExtractWarnings(ctx, "unknown.txt", "-json")
+		assert.Equal(exiftool.ErrUnknownFileType, errors.Cause(err))
+		assert.Contains(string(data), `"Error": "Unknown file type"`)
+		assert.Len(warnings, 1)
+	}
+
+	data, err := exiftool.Extract(os.Args[0], "unknown.txt", "-json")
+	assert.Equal(exiftool.ErrUnknownFileType, errors.Cause(err))
+	assert.Contains(string(data), `"Error": "Unknown file type"`)
+}
+
+// TestBinaryLargeStderr checks a response is read while exiftool writes
+// more to stderr than the pipe holds before it finishes stdout
+func TestBinaryLargeStderr(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "exiftooltest")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	s := &Server{Responses: map[string]Response{
+		"noisy.jpg": {Tags: map[string]interface{}{"Make": "Apple"}, Stderr: strings.Repeat("Warning: Bad IFD\n", 10000)},
+	}}
+	script := filepath.Join(dir, "script.json")
+	if !assert.NoError(s.WriteScript(script)) {
+		return
+	}
+
+	os.Setenv(EnvScript, script)
+	defer os.Unsetenv(EnvScript)
+
+	stayopen, err := exiftool.NewStayOpen(os.Args[0])
+	if !assert.NoError(err) {
+		return
+	}
+	defer stayopen.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, warnings, err := stayopen.ExtractWarnings(ctx, "noisy.jpg", "-json")
+	assert.NoError(err)
+	assert.Len(warnings, 10000)
+
+	// a batch with many missing files writes an error line for each
+	names := make([]string, 3000)
+	for i := range names {
+		names[i] = fmt.Sprintf("missing-%d.jpg", i)
+	}
+	results, err := stayopen.ExtractBatchContext(ctx, names)
+	if assert.NoError(err) && assert.Len(results, 3000) {
+		assert.Equal(exiftool.ErrFileNotFound, errors.Cause(results[2999].Err))
+	}
+}
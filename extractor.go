@@ -0,0 +1,65 @@
+package exiftool
+
+import (
+	"context"
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// Extractor reads metadata with exiftool. It is implemented by Stayopen,
+// Pool, Command, Cache and DiskCache so code that only extracts metadata
+// doesn't need to know how exiftool is run, and tests can substitute their
+// own implementation.
+type Extractor interface {
+	// ExtractWarnings returns exiftool's output for filename along with
+	// any warnings it printed. If exiftool reported an error it is
+	// returned as an *Error together with whatever output and warnings
+	// exiftool printed.
+	ExtractWarnings(ctx context.Context, filename string, flags ...string) ([]byte, []Warning, error)
+
+	// ExtractMetadata returns the parsed metadata of filename
+	ExtractMetadata(ctx context.Context, filename string, flags ...string) (*Metadata, error)
+}
+
+var (
+	_ Extractor = (*Stayopen)(nil)
+	_ Extractor = (*Pool)(nil)
+	_ Extractor = Command("")
+	_ Extractor = (*Cache)(nil)
+	_ Extractor = (*DiskCache)(nil)
+)
+
+// Command is the path to an exiftool binary that is run once for each
+// request, like the package level functions
+type Command string
+
+func (c Command) ExtractMetadata(ctx context.Context, filename string, flags ...string) (*Metadata, error) {
+	return ExtractMetadata(ctx, string(c), filename, flags...)
+}
+
+func (c Command) WriteTags(ctx context.Context, changes TagChanges, filenames ...string) (*WriteResult, error) {
+	return WriteTags(ctx, string(c), changes, filenames...)
+}
+
+func (c Command) ExtractWarnings(ctx context.Context, filename string, flags ...string) ([]byte, []Warning, error) {
+	args, err := readArgs(flags, nil, filename)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stdout, stderr, err := runOutput(ctx, string(c), nil, args)
+	if ctx.Err() != nil {
+		return nil, nil, ctx.Err()
+	}
+
+	warnings, exifErr := parseStderr(stderr)
+	if exifErr != nil {
+		return stdout, warnings, exifErr
+	}
+
+	if _, exited := err.(*exec.ExitError); err != nil && !exited {
+		return nil, nil, errors.Wrap(err, "Failed running exiftool")
+	}
+	return stdout, warnings, nil
+}
@@ -0,0 +1,213 @@
+package exiftool_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	exiftool "github.com/mostlygeek/go-exiftool"
+	"github.com/mostlygeek/go-exiftool/exiftooltest"
+	"github.com/stretchr/testify/assert"
+)
+
+// These tests use the fake from exiftooltest so they don't need perl
+
+// fakeStarter starts fakes of s and keeps the processes so tests can kill
+// them
+type fakeStarter struct {
+	s *exiftooltest.Server
+
+	mu    sync.Mutex
+	procs []exiftool.Process
+}
+
+func newFakeStarter() *fakeStarter {
+	return &fakeStarter{s: &exiftooltest.Server{
+		Responses: map[string]exiftooltest.Response{
+			"a.jpg":    {Tags: map[string]interface{}{"Make": "Apple"}},
+			"slow.jpg": {Tags: map[string]interface{}{"Make": "Nikon"}, Delay: 2 * time.Second},
+			"big.jpg":  {Stdout: strings.Repeat("x", 100000)},
+		},
+	}}
+}
+
+func (f *fakeStarter) Start(path string, args ...string) (exiftool.Process, error) {
+	p, err := f.s.Start(path, args...)
+	if err == nil {
+		f.mu.Lock()
+		f.procs = append(f.procs, p)
+		f.mu.Unlock()
+	}
+	return p, err
+}
+
+// last returns the process started most recently
+func (f *fakeStarter) last() exiftool.Process {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.procs[len(f.procs)-1]
+}
+
+func TestStayOpenContextCanceled(t *testing.T) {
+	assert := assert.New(t)
+
+	stayopen, err := exiftool.NewStayOpenStarter(newFakeStarter().Start, "exiftool", "-json")
+	if !assert.NoError(err) {
+		return
+	}
+	defer stayopen.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = stayopen.ExtractFlagsContext(ctx, "a.jpg")
+	assert.Equal(context.Canceled, err)
+
+	// a request that times out replaces the process
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = stayopen.ExtractFlagsContext(ctx, "slow.jpg")
+	assert.Equal(context.DeadlineExceeded, err)
+
+	// the stayopen should still be usable afterwards
+	m, err := stayopen.ExtractMetadata(context.Background(), "a.jpg")
+	if assert.NoError(err) {
+		mk, _ := m.GetString("Make")
+		assert.Equal("Apple", mk)
+	}
+}
+
+func TestStayOpenRestartsAfterCrash(t *testing.T) {
+	assert := assert.New(t)
+
+	f := newFakeStarter()
+	stayopen, err := exiftool.NewStayOpenStarter(f.Start, "exiftool", "-json")
+	if !assert.NoError(err) {
+		return
+	}
+	defer stayopen.Stop()
+
+	var reasons []error
+	var restarts []int
+	stayopen.OnRestart = func(err error) {
+		reasons = append(reasons, err)
+		restarts = append(restarts, stayopen.Restarts())
+	}
+
+	// simulate the process being OOM killed
+	f.last().Kill()
+
+	m, err := stayopen.ExtractMetadata(context.Background(), "a.jpg")
+	if assert.NoError(err) {
+		mk, _ := m.GetString("Make")
+		assert.Equal("Apple", mk)
+	}
+
+	assert.Equal(1, stayopen.Restarts())
+	assert.Len(reasons, 1)
+	assert.Equal([]int{1}, restarts)
+}
+
+func TestStayOpenRestartsWithoutRetry(t *testing.T) {
+	assert := assert.New(t)
+
+	f := newFakeStarter()
+	stayopen, err := exiftool.NewStayOpenStarter(f.Start, "exiftool", "-json")
+	if !assert.NoError(err) {
+		return
+	}
+	defer stayopen.Stop()
+
+	stayopen.MaxRetries = 0
+	f.last().Kill()
+
+	// the request in flight fails but the process is still replaced
+	_, err = stayopen.Extract("a.jpg")
+	assert.Error(err)
+	assert.Equal(1, stayopen.Restarts())
+
+	_, err = stayopen.Extract("a.jpg")
+	assert.NoError(err)
+}
+
+func TestStayOpenMaxResponseSize(t *testing.T) {
+	assert := assert.New(t)
+
+	stayopen, err := exiftool.NewStayOpenStarter(newFakeStarter().Start, "exiftool", "-json")
+	if !assert.NoError(err) {
+		return
+	}
+	defer stayopen.Stop()
+
+	stayopen.MaxResponseSize = 1000
+	_, err = stayopen.Extract("big.jpg")
+	assert.Equal(exiftool.ErrResponseTooLarge, err)
+
+	// the stream is back in step once the limit is lifted
+	stayopen.MaxResponseSize = 0
+	data, err := stayopen.Extract("big.jpg")
+	assert.NoError(err)
+	assert.Len(data, 100000)
+
+	m, err := stayopen.ExtractMetadata(context.Background(), "a.jpg")
+	if assert.NoError(err) {
+		mk, _ := m.GetString("Make")
+		assert.Equal("Apple", mk)
+	}
+}
+
+func TestPoolContextCanceled(t *testing.T) {
+	assert := assert.New(t)
+
+	pool, err := exiftool.NewPoolConfig(exiftool.PoolConfig{Size: 2, Starter: newFakeStarter().Start})
+	if !assert.NoError(err) {
+		return
+	}
+	defer pool.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = pool.ExtractFlagsContext(ctx, "a.jpg")
+	assert.Equal(context.Canceled, err)
+}
+
+func TestPoolExtractReaderSpoolsFirst(t *testing.T) {
+	assert := assert.New(t)
+
+	pool, err := exiftool.NewPoolConfig(exiftool.PoolConfig{Size: 1, Starter: newFakeStarter().Start})
+	if !assert.NoError(err) {
+		return
+	}
+	defer pool.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		_, _, err := pool.ExtractReaderWarnings(ctx, pr)
+		errc <- err
+	}()
+	pw.Write([]byte("first"))
+
+	// the worker is free while the stream is still being copied
+	assert.Equal([]int{0}, pool.Stats().QueueDepths)
+	_, err = pool.ExtractFlagsContext(context.Background(), "a.jpg")
+	assert.NoError(err)
+
+	// and the copy stops at the next read once ctx is done
+	cancel()
+	pw.Write([]byte("second"))
+	select {
+	case err := <-errc:
+		assert.Equal(context.Canceled, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the copy didn't stop")
+	}
+	pw.Close()
+}
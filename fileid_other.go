@@ -0,0 +1,12 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package exiftool
+
+import "os"
+
+// inode returns 0 as os.FileInfo has no file index on this platform. The
+// path, size and modification time still identify the file.
+func inode(info os.FileInfo) uint64 {
+	return 0
+}
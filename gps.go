@@ -0,0 +1,216 @@
+package exiftool
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNoLocation is returned by Location when the file has no GPS position
+var ErrNoLocation = errors.New("No GPS location")
+
+// Location is the GPS information recorded in a file. Optional values are
+// nil when the file doesn't have them.
+type Location struct {
+	// Latitude and Longitude are signed decimal degrees. South and west
+	// are negative.
+	Latitude  float64
+	Longitude float64
+
+	// Altitude is in metres and negative below sea level
+	Altitude *float64
+
+	// Direction is the direction the camera was pointing in degrees,
+	// relative to DirectionRef which is "True North" or "Magnetic North"
+	Direction    *float64
+	DirectionRef string
+
+	// Speed is how fast the receiver was moving, in SpeedRef units which
+	// are "km/h", "mph" or "knots"
+	Speed    *float64
+	SpeedRef string
+
+	// DOP is the dilution of precision of the fix
+	DOP *float64
+
+	// Time is the UTC time of the fix or the zero time.Time if unknown
+	Time time.Time
+}
+
+var numberRegexp = regexp.MustCompile(`[-+]?\d+(\.\d+)?`)
+
+// Location returns the file's GPS information. It works with the values
+// exiftool prints by default and with the numbers printed when -n is used.
+// ErrNoLocation is returned when the file has no GPS position.
+func (m *Metadata) Location() (*Location, error) {
+	lat, lon, err := m.coordinates()
+	if err != nil {
+		return nil, err
+	}
+
+	loc := &Location{Latitude: lat, Longitude: lon}
+
+	if s, _ := m.optionalString("GPSAltitude"); s != "" {
+		alt, ok := firstNumber(s)
+		if !ok {
+			return nil, errors.Errorf("GPSAltitude is not a number: %q", s)
+		}
+		ref, _ := m.optionalString("GPSAltitudeRef")
+		if alt > 0 && (strings.Contains(s, "Below") || strings.HasPrefix(ref, "Below") || ref == "1") {
+			alt = -alt
+		}
+		loc.Altitude = &alt
+	}
+
+	if s, _ := m.optionalString("GPSImgDirection"); s != "" {
+		dir, ok := firstNumber(s)
+		if !ok {
+			return nil, errors.Errorf("GPSImgDirection is not a number: %q", s)
+		}
+		loc.Direction = &dir
+
+		ref, _ := m.optionalString("GPSImgDirectionRef")
+		switch strings.ToUpper(ref) {
+		case "M", "MAGNETIC NORTH":
+			loc.DirectionRef = "Magnetic North"
+		default:
+			loc.DirectionRef = "True North"
+		}
+	}
+
+	if s, _ := m.optionalString("GPSSpeed"); s != "" {
+		speed, ok := firstNumber(s)
+		if !ok {
+			return nil, errors.Errorf("GPSSpeed is not a number: %q", s)
+		}
+		loc.Speed = &speed
+
+		ref, _ := m.optionalString("GPSSpeedRef")
+		switch strings.ToLower(ref) {
+		case "m", "mph":
+			loc.SpeedRef = "mph"
+		case "n", "knots":
+			loc.SpeedRef = "knots"
+		default:
+			loc.SpeedRef = "km/h"
+		}
+	}
+
+	if s, _ := m.optionalString("GPSDOP"); s != "" {
+		dop, ok := firstNumber(s)
+		if !ok {
+			return nil, errors.Errorf("GPSDOP is not a number: %q", s)
+		}
+		loc.DOP = &dop
+	}
+
+	for _, src := range []dateSource{
+		{date: "GPSDateTime", utc: true},
+		{date: "GPSDateStamp", clock: "GPSTimeStamp", utc: true},
+	} {
+		d, ok, err := m.dateFrom(src)
+		if err != nil {
+			return nil, err
+		}
+		if ok && !d.IsZero() {
+			loc.Time = d.Time.UTC()
+			break
+		}
+	}
+
+	return loc, nil
+}
+
+// coordinates finds the latitude and longitude in GPSLatitude and
+// GPSLongitude, falling back to the combined GPSPosition and QuickTime's
+// GPSCoordinates
+func (m *Metadata) coordinates() (float64, float64, error) {
+	latStr, _ := m.optionalString("GPSLatitude")
+	lonStr, _ := m.optionalString("GPSLongitude")
+
+	if latStr == "" || lonStr == "" {
+		pos, _ := m.optionalString("GPSPosition")
+		if pos == "" {
+			pos, _ = m.optionalString("GPSCoordinates")
+		}
+
+		parts := strings.Split(pos, ",")
+		if len(parts) < 2 {
+			parts = strings.Fields(pos)
+		}
+		if len(parts) < 2 {
+			return 0, 0, ErrNoLocation
+		}
+		latStr, lonStr = parts[0], parts[1]
+	}
+
+	latRef, _ := m.optionalString("GPSLatitudeRef")
+	lat, err := parseCoordinate(latStr, latRef, "S")
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "GPSLatitude")
+	}
+
+	lonRef, _ := m.optionalString("GPSLongitudeRef")
+	lon, err := parseCoordinate(lonStr, lonRef, "W")
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "GPSLongitude")
+	}
+
+	return lat, lon, nil
+}
+
+// parseCoordinate parses coordinates like `37 deg 46' 29.64" N`, `37.7749`
+// and `-122.4194` into signed decimal degrees. When s has no hemisphere or
+// sign, ref is used and a ref starting with negative ("S" or "W") flips the
+// sign.
+func parseCoordinate(s, ref, negative string) (float64, error) {
+	s = strings.TrimSpace(s)
+	nums := numberRegexp.FindAllString(s, 3)
+	if len(nums) == 0 {
+		return 0, errors.Errorf("Not a coordinate: %q", s)
+	}
+
+	// degrees, minutes and seconds
+	var deg float64
+	for i, n := range nums {
+		f, err := strconv.ParseFloat(strings.TrimLeft(n, "+-"), 64)
+		if err != nil {
+			return 0, errors.Errorf("Not a coordinate: %q", s)
+		}
+		deg += f / []float64{1, 60, 3600}[i]
+	}
+
+	if strings.HasPrefix(nums[0], "-") {
+		return -deg, nil
+	}
+
+	// the hemisphere is the last letter in values like `37 deg 46' N`
+	hemisphere := ""
+	if fields := strings.Fields(s); len(fields) > 0 {
+		last := strings.ToUpper(fields[len(fields)-1])
+		if last == "N" || last == "S" || last == "E" || last == "W" {
+			hemisphere = last
+		}
+	}
+	if hemisphere == "" {
+		hemisphere = strings.ToUpper(strings.TrimSpace(ref))
+	}
+
+	if strings.HasPrefix(hemisphere, negative) {
+		deg = -deg
+	}
+	return deg, nil
+}
+
+// firstNumber returns the first number in s, ignoring units
+func firstNumber(s string) (float64, bool) {
+	n := numberRegexp.FindString(s)
+	if n == "" {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(n, 64)
+	return f, err == nil
+}
@@ -0,0 +1,154 @@
+package exiftool
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCoordinate(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		in  string
+		ref string
+		out float64
+	}{
+		{`37 deg 46' 29.64" N`, "", 37.7749},
+		{`37 deg 46' 29.64" S`, "North", -37.7749},
+		{`122 deg 25' 9.84"`, "West", -122.4194},
+		{`122 deg 25' 9.84"`, "East", 122.4194},
+		{"122.4194", "W", -122.4194},
+		{"-122.4194", "W", -122.4194},
+		{"+37.7749", "", 37.7749},
+		{"37.774900 N", "", 37.7749},
+	}
+
+	for _, test := range tests {
+		negative := "S"
+		if test.ref == "West" || test.ref == "W" || test.ref == "East" {
+			negative = "W"
+		}
+		out, err := parseCoordinate(test.in, test.ref, negative)
+		if assert.NoError(err, test.in) {
+			assert.InDelta(test.out, out, 0.000001, test.in)
+		}
+	}
+
+	_, err := parseCoordinate("unknown", "", "S")
+	assert.Error(err)
+}
+
+func TestLocation(t *testing.T) {
+	assert := assert.New(t)
+
+	list, err := ParseMetadata([]byte(`[{
+		"GPSLatitudeRef": "South",
+		"GPSLongitudeRef": "West",
+		"GPSLatitude": "33 deg 51' 21.96\" S",
+		"GPSLongitude": "151 deg 12' 55.08\" E",
+		"GPSAltitude": "12.5 m Below Sea Level",
+		"GPSImgDirection": 271.5,
+		"GPSImgDirectionRef": "Magnetic North",
+		"GPSSpeed": 0,
+		"GPSSpeedRef": "km/h",
+		"GPSDOP": 5,
+		"GPSDateTime": "2016:06:18 02:16:43Z"
+	}, {
+		"GPSLatitude": 33.8561,
+		"GPSLatitudeRef": "S",
+		"GPSLongitude": 151.2153,
+		"GPSLongitudeRef": "E",
+		"GPSAltitude": 12.5,
+		"GPSAltitudeRef": 1,
+		"GPSSpeedRef": "N",
+		"GPSSpeed": 2,
+		"GPSDateStamp": "2016:06:18",
+		"GPSTimeStamp": "02:16:43"
+	}, {
+		"Make": "Apple"
+	}]`))
+	if !assert.NoError(err) {
+		return
+	}
+
+	for _, meta := range list[:2] {
+		loc, err := meta.Location()
+		if !assert.NoError(err) {
+			continue
+		}
+
+		// the hemisphere in the value wins over the ref tag
+		assert.InDelta(-33.8561, loc.Latitude, 0.0001)
+		assert.InDelta(151.2153, loc.Longitude, 0.0001)
+		if assert.NotNil(loc.Altitude) {
+			assert.Equal(-12.5, *loc.Altitude)
+		}
+		assert.Equal(time.Date(2016, 6, 18, 2, 16, 43, 0, time.UTC), loc.Time)
+	}
+
+	loc, err := list[0].Location()
+	if assert.NoError(err) {
+		assert.Equal(271.5, *loc.Direction)
+		assert.Equal("Magnetic North", loc.DirectionRef)
+		assert.Equal(0.0, *loc.Speed)
+		assert.Equal("km/h", loc.SpeedRef)
+		assert.Equal(5.0, *loc.DOP)
+	}
+
+	loc, err = list[1].Location()
+	if assert.NoError(err) {
+		assert.Nil(loc.Direction)
+		assert.Nil(loc.DOP)
+		assert.Equal("knots", loc.SpeedRef)
+	}
+
+	_, err = list[2].Location()
+	assert.Equal(ErrNoLocation, err)
+}
+
+func TestLocationPosition(t *testing.T) {
+	assert := assert.New(t)
+
+	list, err := ParseMetadata([]byte(`[
+		{"GPSPosition": "37 deg 46' 29.64\" N, 122 deg 25' 9.84\" W"},
+		{"GPSCoordinates": "37.7749 -122.4194 10"}
+	]`))
+	if !assert.NoError(err) {
+		return
+	}
+
+	for _, meta := range list {
+		loc, err := meta.Location()
+		if assert.NoError(err) {
+			assert.InDelta(37.7749, loc.Latitude, 0.0001)
+			assert.InDelta(-122.4194, loc.Longitude, 0.0001)
+		}
+	}
+}
+
+func TestLocationExtract(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, flags := range [][]string{nil, {"-n"}} {
+		meta, err := ExtractMetadata(context.Background(), "exiftool", "testdata/IMG_7238-geo.jpg", flags...)
+		if !assert.NoError(err) {
+			return
+		}
+
+		loc, err := meta.Location()
+		if assert.NoError(err) {
+			assert.NotEqual(0.0, loc.Latitude)
+			assert.NotEqual(0.0, loc.Longitude)
+		}
+	}
+
+	meta, err := ExtractMetadata(context.Background(), "exiftool", "testdata/IMG_7238-nogeo.jpg")
+	if !assert.NoError(err) {
+		return
+	}
+	_, err = meta.Location()
+	assert.Equal(ErrNoLocation, err)
+}
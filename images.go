@@ -0,0 +1,205 @@
+package exiftool
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNoImage is returned when a file doesn't have the requested embedded
+// image
+var ErrNoImage = errors.New("No embedded image")
+
+// ImageTags are the tags embedded images are stored in, from the usually
+// smallest to the usually largest
+var ImageTags = []string{
+	"ThumbnailImage",
+	"ThumbnailTIFF",
+	"PreviewImage",
+	"PreviewTIFF",
+	"OtherImage",
+	"JpgFromRaw",
+}
+
+// ImageInfo describes an image embedded in a file's metadata
+type ImageInfo struct {
+	Tag  string
+	Size int64
+
+	// MIMEType is guessed from the tag when listing images and detected
+	// from the data when extracting them
+	MIMEType string
+}
+
+// Image is an embedded image extracted with -b. Read it to get the image
+// data.
+type Image struct {
+	ImageInfo
+	io.Reader
+}
+
+var binaryDataRegexp = regexp.MustCompile(`^\(Binary data (\d+) bytes`)
+
+// imageMIMEType guesses the format of an embedded image from its tag
+func imageMIMEType(tag string) string {
+	switch tag {
+	case "ThumbnailTIFF", "PreviewTIFF":
+		return "image/tiff"
+	}
+	return "image/jpeg"
+}
+
+// listImages returns the embedded images in filename without extracting
+// them. exiftool prints `(Binary data 1234 bytes, ...)` for them unless -b
+// is used.
+func listImages(ctx context.Context, e Extractor, filename string) ([]ImageInfo, error) {
+	flags := []string{"-json"}
+	for _, tag := range ImageTags {
+		flags = append(flags, "-"+tag)
+	}
+
+	data, warnings, err := e.ExtractWarnings(ctx, filename, flags...)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := parseSingleMetadata(data, warnings)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []ImageInfo
+	for _, tag := range ImageTags {
+		s, err := meta.GetString(tag)
+		if err != nil {
+			continue
+		}
+
+		var size int64
+		if match := binaryDataRegexp.FindStringSubmatch(s); match != nil {
+			size, _ = strconv.ParseInt(match[1], 10, 64)
+		} else if b, err := decodeBytes(s); err == nil {
+			size = int64(len(b)) // exiftool was started with -b
+		}
+
+		if size > 0 {
+			images = append(images, ImageInfo{Tag: tag, Size: size, MIMEType: imageMIMEType(tag)})
+		}
+	}
+	return images, nil
+}
+
+// extractImage extracts a single embedded image with -b
+func extractImage(ctx context.Context, e Extractor, filename, tag string) (*Image, error) {
+	if err := validateTagName(tag); err != nil {
+		return nil, err
+	}
+
+	data, warnings, err := e.ExtractWarnings(ctx, filename, "-b", "-"+tag)
+	if err != nil {
+		return nil, err
+	}
+
+	// a Stayopen started with -json prints the image base64 encoded
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		meta, err := parseSingleMetadata(data, warnings)
+		if err != nil {
+			return nil, err
+		}
+		data, err = meta.GetBytes(tag)
+		if err == ErrTagNotFound {
+			return nil, ErrNoImage
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(data) == 0 {
+		return nil, ErrNoImage
+	}
+
+	return &Image{
+		ImageInfo: ImageInfo{
+			Tag:      tag,
+			Size:     int64(len(data)),
+			MIMEType: http.DetectContentType(data),
+		},
+		Reader: bytes.NewReader(data),
+	}, nil
+}
+
+// largestPreview extracts the biggest embedded image
+func largestPreview(ctx context.Context, e Extractor, filename string) (*Image, error) {
+	images, err := listImages(ctx, e, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var largest *ImageInfo
+	for i := range images {
+		if largest == nil || images[i].Size > largest.Size {
+			largest = &images[i]
+		}
+	}
+	if largest == nil {
+		return nil, ErrNoImage
+	}
+
+	return extractImage(ctx, e, filename, largest.Tag)
+}
+
+// ListImages returns the images embedded in filename, such as thumbnails
+// and previews, without extracting them
+func ListImages(ctx context.Context, exiftool, filename string) ([]ImageInfo, error) {
+	return listImages(ctx, Command(exiftool), filename)
+}
+
+// ExtractImage extracts the embedded image in tag, such as ThumbnailImage
+// or JpgFromRaw. ErrNoImage is returned if the file doesn't have it.
+func ExtractImage(ctx context.Context, exiftool, filename, tag string) (*Image, error) {
+	return extractImage(ctx, Command(exiftool), filename, tag)
+}
+
+// LargestPreview extracts the largest of the images in ImageTags.
+// ErrNoImage is returned if the file has none of them.
+func LargestPreview(ctx context.Context, exiftool, filename string) (*Image, error) {
+	return largestPreview(ctx, Command(exiftool), filename)
+}
+
+// ListImages returns the images embedded in filename without extracting
+// them
+func (e *Stayopen) ListImages(ctx context.Context, filename string) ([]ImageInfo, error) {
+	return listImages(ctx, e, filename)
+}
+
+// ExtractImage extracts the embedded image in tag. See the package level
+// ExtractImage.
+func (e *Stayopen) ExtractImage(ctx context.Context, filename, tag string) (*Image, error) {
+	return extractImage(ctx, e, filename, tag)
+}
+
+// LargestPreview extracts the largest of the images in ImageTags
+func (e *Stayopen) LargestPreview(ctx context.Context, filename string) (*Image, error) {
+	return largestPreview(ctx, e, filename)
+}
+
+// ListImages returns the images embedded in filename without extracting
+// them
+func (p *Pool) ListImages(ctx context.Context, filename string) ([]ImageInfo, error) {
+	return listImages(ctx, p, filename)
+}
+
+// ExtractImage extracts the embedded image in tag. See the package level
+// ExtractImage.
+func (p *Pool) ExtractImage(ctx context.Context, filename, tag string) (*Image, error) {
+	return extractImage(ctx, p, filename, tag)
+}
+
+// LargestPreview extracts the largest of the images in ImageTags
+func (p *Pool) LargestPreview(ctx context.Context, filename string) (*Image, error) {
+	return largestPreview(ctx, p, filename)
+}
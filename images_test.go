@@ -0,0 +1,76 @@
+package exiftool
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListImages(t *testing.T) {
+	assert := assert.New(t)
+
+	images, err := ListImages(context.Background(), "exiftool", "testdata/IMG_7238.JPG")
+	if !assert.NoError(err) || !assert.NotEmpty(images) {
+		return
+	}
+
+	assert.Equal("ThumbnailImage", images[0].Tag)
+	assert.Equal("image/jpeg", images[0].MIMEType)
+	assert.NotZero(images[0].Size)
+}
+
+func TestExtractImage(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := context.Background()
+	image, err := ExtractImage(ctx, "exiftool", "testdata/IMG_7238.JPG", "ThumbnailImage")
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal("image/jpeg", image.MIMEType)
+
+	data, err := ioutil.ReadAll(image)
+	assert.NoError(err)
+	assert.Equal(image.Size, int64(len(data)))
+	assert.True(bytes.HasPrefix(data, []byte{0xff, 0xd8}))
+
+	_, err = ExtractImage(ctx, "exiftool", "testdata/IMG_7238.JPG", "JpgFromRaw")
+	assert.Equal(ErrNoImage, err)
+}
+
+func TestStayOpenImages(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := context.Background()
+	for _, flags := range [][]string{nil, {"-json"}} {
+		stayopen, err := NewStayOpen("exiftool", flags...)
+		if !assert.NoError(err) {
+			return
+		}
+
+		images, err := stayopen.ListImages(ctx, "testdata/IMG_7238.JPG")
+		if !assert.NoError(err) {
+			stayopen.Stop()
+			return
+		}
+
+		largest, err := stayopen.LargestPreview(ctx, "testdata/IMG_7238.JPG")
+		if assert.NoError(err, "flags %v", flags) {
+			for _, i := range images {
+				assert.True(largest.Size >= i.Size)
+			}
+			data, _ := ioutil.ReadAll(largest)
+			assert.Equal(largest.Size, int64(len(data)))
+		}
+
+		thumb, err := stayopen.ExtractImage(ctx, "testdata/IMG_7238.JPG", "ThumbnailImage")
+		if assert.NoError(err, "flags %v", flags) {
+			assert.Equal("image/jpeg", thumb.MIMEType)
+		}
+
+		stayopen.Stop()
+	}
+}
@@ -0,0 +1,386 @@
+package exiftool
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/buger/jsonparser"
+	"github.com/pkg/errors"
+)
+
+// ErrTagNotFound is returned by the Metadata accessors when a tag is missing
+var ErrTagNotFound = errors.New("Tag not found")
+
+// Metadata holds the tags exiftool extracted from a single file with -json.
+//
+// Tags can be looked up by name (`Make`) or, when the output was grouped
+// with -G, by group qualified name (`EXIF:Make`). An unqualified name
+// matches the first tag with that name in any group.
+type Metadata struct {
+	// Warnings exiftool printed while extracting the metadata
+	Warnings []Warning
+
+	raw  []byte
+	tags []string
+	vals map[string]value
+}
+
+type value struct {
+	data []byte
+	typ  jsonparser.ValueType
+}
+
+// text returns a string, number or boolean value as a string
+func (v value) text() (string, bool) {
+	switch v.typ {
+	case jsonparser.String:
+		s, err := jsonparser.ParseString(v.data)
+		return s, err == nil
+	case jsonparser.Number, jsonparser.Boolean:
+		return string(v.data), true
+	default:
+		return "", false
+	}
+}
+
+// ParseMetadata parses the JSON array exiftool prints with -json into one
+// *Metadata per file
+func ParseMetadata(data []byte) ([]*Metadata, error) {
+	var list []*Metadata
+	var parseErr error
+
+	_, err := jsonparser.ArrayEach(data, func(obj []byte, typ jsonparser.ValueType, _ int, err error) {
+		if parseErr != nil {
+			return
+		}
+		if err != nil {
+			parseErr = err
+			return
+		}
+		if typ != jsonparser.Object {
+			parseErr = errors.New("Expected a JSON object for each file")
+			return
+		}
+
+		m, err := newMetadata(obj)
+		if err != nil {
+			parseErr = err
+			return
+		}
+		list = append(list, m)
+	})
+
+	if err == nil {
+		err = parseErr
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed parsing metadata")
+	}
+
+	return list, nil
+}
+
+// parseSingleMetadata parses output for a single file
+func parseSingleMetadata(data []byte, warnings []Warning) (*Metadata, error) {
+	list, err := ParseMetadata(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(list) == 0 {
+		return nil, errors.New("No metadata")
+	}
+
+	list[0].Warnings = warnings
+	return list[0], nil
+}
+
+func newMetadata(obj []byte) (*Metadata, error) {
+	m := &Metadata{
+		raw:  copyBytes(obj),
+		vals: make(map[string]value),
+	}
+
+	err := jsonparser.ObjectEach(m.raw, func(key, data []byte, typ jsonparser.ValueType, _ int) error {
+		tag := string(key)
+		if _, ok := m.vals[tag]; !ok {
+			m.tags = append(m.tags, tag)
+		}
+		m.vals[tag] = value{data: data, typ: typ}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Tags returns the names of all tags in the order exiftool printed them
+func (m *Metadata) Tags() []string {
+	tags := make([]string, len(m.tags))
+	copy(tags, m.tags)
+	return tags
+}
+
+// Has returns true if the tag exists
+func (m *Metadata) Has(tag string) bool {
+	_, ok := m.lookup(tag)
+	return ok
+}
+
+func (m *Metadata) lookup(tag string) (value, bool) {
+	key, ok := m.key(tag)
+	return m.vals[key], ok
+}
+
+// key returns the name exiftool printed for tag
+func (m *Metadata) key(tag string) (string, bool) {
+	if _, ok := m.vals[tag]; ok {
+		return tag, true
+	}
+
+	// an unqualified name matches the tag in any group
+	if !strings.Contains(tag, ":") {
+		for _, t := range m.tags {
+			if i := strings.LastIndex(t, ":"); i != -1 && t[i+1:] == tag {
+				return t, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// GetString returns the tag's value as a string. Numbers and booleans are
+// returned as they appear in the JSON.
+func (m *Metadata) GetString(tag string) (string, error) {
+	v, ok := m.lookup(tag)
+	if !ok {
+		return "", ErrTagNotFound
+	}
+
+	s, ok := v.text()
+	if !ok {
+		return "", errors.Errorf("%s is not a string", tag)
+	}
+	return s, nil
+}
+
+// GetInt returns the tag's value as an integer
+func (m *Metadata) GetInt(tag string) (int64, error) {
+	s, err := m.GetString(tag)
+	if err != nil {
+		return 0, err
+	}
+
+	i, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0, errors.Errorf("%s is not an integer: %q", tag, s)
+	}
+	return i, nil
+}
+
+// GetFloat returns the tag's value as a float. Rational values such as
+// `1/125` are evaluated.
+func (m *Metadata) GetFloat(tag string) (float64, error) {
+	s, err := m.GetString(tag)
+	if err != nil {
+		return 0, err
+	}
+
+	f, ok := parseFloat(s)
+	if !ok {
+		return 0, errors.Errorf("%s is not a number: %q", tag, s)
+	}
+	return f, nil
+}
+
+func parseFloat(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	if i := strings.Index(s, "/"); i != -1 {
+		num, err1 := strconv.ParseFloat(strings.TrimSpace(s[:i]), 64)
+		den, err2 := strconv.ParseFloat(strings.TrimSpace(s[i+1:]), 64)
+		if err1 != nil || err2 != nil || den == 0 {
+			return 0, false
+		}
+		return num / den, true
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil
+}
+
+// GetBool returns the tag's value as a boolean. Besides JSON booleans it
+// understands numbers and the Yes/No, True/False and On/Off strings
+// exiftool prints.
+func (m *Metadata) GetBool(tag string) (bool, error) {
+	s, err := m.GetString(tag)
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := parseBool(s)
+	if !ok {
+		return false, errors.Errorf("%s is not a boolean: %q", tag, s)
+	}
+	return b, nil
+}
+
+func parseBool(s string) (bool, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "true", "yes", "on", "1":
+		return true, true
+	case "false", "no", "off", "0":
+		return false, true
+	}
+	return false, false
+}
+
+// GetStrings returns the items of a list tag. A tag with a single value is
+// returned as a list with one item.
+func (m *Metadata) GetStrings(tag string) ([]string, error) {
+	v, ok := m.lookup(tag)
+	if !ok {
+		return nil, ErrTagNotFound
+	}
+
+	if v.typ != jsonparser.Array {
+		s, err := m.GetString(tag)
+		if err != nil {
+			return nil, err
+		}
+		return []string{s}, nil
+	}
+
+	list, ok := v.texts()
+	if !ok {
+		return nil, errors.Errorf("%s contains a value that is not a string", tag)
+	}
+	return list, nil
+}
+
+// texts returns the items of an array value as strings
+func (v value) texts() ([]string, bool) {
+	list := []string{}
+	ok := true
+	_, err := jsonparser.ArrayEach(v.data, func(data []byte, typ jsonparser.ValueType, _ int, _ error) {
+		s, isText := value{data: data, typ: typ}.text()
+		if !isText {
+			ok = false
+			return
+		}
+		list = append(list, s)
+	})
+
+	if err != nil || !ok {
+		return nil, false
+	}
+	return list, true
+}
+
+// GetBytes returns the tag's value as bytes. Binary values extracted with
+// -b are base64 decoded.
+func (m *Metadata) GetBytes(tag string) ([]byte, error) {
+	s, err := m.GetString(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := decodeBytes(s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s is not valid base64", tag)
+	}
+	return b, nil
+}
+
+// decodeBytes decodes the base64: prefixed strings exiftool uses for binary
+// values in JSON
+func decodeBytes(s string) ([]byte, error) {
+	if strings.HasPrefix(s, "base64:") {
+		return base64.StdEncoding.DecodeString(s[7:])
+	}
+	return []byte(s), nil
+}
+
+// MIMEType returns the file's MIME type or an empty string if it is unknown
+func (m *Metadata) MIMEType() string {
+	mime, _ := m.GetString("MIMEType")
+	return mime
+}
+
+// MarshalJSON returns the JSON object exiftool printed for the file
+func (m *Metadata) MarshalJSON() ([]byte, error) {
+	return copyBytes(m.raw), nil
+}
+
+// ExtractMetadata calls exiftool with -json on filename and parses the output
+func ExtractMetadata(ctx context.Context, exiftool, filename string, flags ...string) (*Metadata, error) {
+	args, err := readArgs(append(flags[:len(flags):len(flags)], "-json"), nil, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	data, warnings, err := run(ctx, exiftool, nil, args)
+	if err != nil {
+		return nil, err
+	}
+	return parseSingleMetadata(data, warnings)
+}
+
+// ExtractReaderMetadata is like ExtractMetadata but passes the data from
+// source to exiftool via stdin
+func ExtractReaderMetadata(ctx context.Context, exiftool string, source io.Reader, flags ...string) (*Metadata, error) {
+	if err := CheckFlags(flags); err != nil {
+		return nil, err
+	}
+
+	data, warnings, err := run(ctx, exiftool, source, append(flags[:len(flags):len(flags)], "-json", "-"))
+	if err != nil {
+		return nil, err
+	}
+	return parseSingleMetadata(data, warnings)
+}
+
+// ExtractMetadata calls exiftool with -json on filename and parses the output
+func (e *Stayopen) ExtractMetadata(ctx context.Context, filename string, flags ...string) (*Metadata, error) {
+	data, warnings, err := e.ExtractWarnings(ctx, filename, append(flags[:len(flags):len(flags)], "-json")...)
+	if err != nil {
+		return nil, err
+	}
+	return parseSingleMetadata(data, warnings)
+}
+
+// ExtractMetadata calls exiftool with -json on filename and parses the output
+func (p *Pool) ExtractMetadata(ctx context.Context, filename string, flags ...string) (*Metadata, error) {
+	data, warnings, err := p.ExtractWarnings(ctx, filename, append(flags[:len(flags):len(flags)], "-json")...)
+	if err != nil {
+		return nil, err
+	}
+	return parseSingleMetadata(data, warnings)
+}
+
+// ExtractReaderMetadata is like ExtractMetadata but reads the file from
+// source. See Stayopen.ExtractReader.
+func (e *Stayopen) ExtractReaderMetadata(ctx context.Context, source io.Reader, flags ...string) (*Metadata, error) {
+	data, warnings, err := e.ExtractReaderWarnings(ctx, source, append(flags[:len(flags):len(flags)], "-json")...)
+	if err != nil {
+		return nil, err
+	}
+	return parseSingleMetadata(data, warnings)
+}
+
+// ExtractReaderMetadata is like ExtractMetadata but reads the file from
+// source. See Stayopen.ExtractReader.
+func (p *Pool) ExtractReaderMetadata(ctx context.Context, source io.Reader, flags ...string) (*Metadata, error) {
+	data, warnings, err := p.ExtractReaderWarnings(ctx, source, append(flags[:len(flags):len(flags)], "-json")...)
+	if err != nil {
+		return nil, err
+	}
+	return parseSingleMetadata(data, warnings)
+}
@@ -0,0 +1,229 @@
+package exiftool
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testMetadataJSON = []byte(`[{
+  "SourceFile": "testdata/IMG_7238.JPG",
+  "File:MIMEType": "image/jpeg",
+  "EXIF:Make": "Apple",
+  "XMP:Make": "Apple Inc.",
+  "EXIF:ISO": 25,
+  "EXIF:ExposureTime": "1/123",
+  "EXIF:FNumber": 2.2,
+  "Composite:Flash": "No",
+  "XMP:Subject": ["cat", "garden", 2016],
+  "EXIF:ThumbnailImage": "base64:aGVsbG8=",
+  "XMP:Title": "quote \" and é"
+}]`)
+
+func TestParseMetadata(t *testing.T) {
+	assert := assert.New(t)
+
+	list, err := ParseMetadata(testMetadataJSON)
+	if !assert.NoError(err) || !assert.Len(list, 1) {
+		return
+	}
+	meta := list[0]
+
+	assert.Equal("image/jpeg", meta.MIMEType())
+	assert.Equal("SourceFile", meta.Tags()[0])
+
+	// group qualified and unqualified lookups
+	mk, err := meta.GetString("EXIF:Make")
+	assert.NoError(err)
+	assert.Equal("Apple", mk)
+
+	mk, err = meta.GetString("XMP:Make")
+	assert.NoError(err)
+	assert.Equal("Apple Inc.", mk)
+
+	mk, err = meta.GetString("Make")
+	assert.NoError(err)
+	assert.Equal("Apple", mk)
+
+	assert.True(meta.Has("ISO"))
+	assert.False(meta.Has("IPTC:Make"))
+	assert.False(meta.Has("Model"))
+
+	_, err = meta.GetString("Model")
+	assert.Equal(ErrTagNotFound, err)
+
+	title, err := meta.GetString("Title")
+	assert.NoError(err)
+	assert.Equal("quote \" and é", title)
+}
+
+func TestMetadataConversions(t *testing.T) {
+	assert := assert.New(t)
+
+	list, err := ParseMetadata(testMetadataJSON)
+	if !assert.NoError(err) {
+		return
+	}
+	meta := list[0]
+
+	iso, err := meta.GetInt("ISO")
+	assert.NoError(err)
+	assert.Equal(int64(25), iso)
+
+	_, err = meta.GetInt("Make")
+	assert.Error(err)
+
+	exposure, err := meta.GetFloat("ExposureTime")
+	assert.NoError(err)
+	assert.InDelta(1.0/123, exposure, 0.000001)
+
+	fnumber, err := meta.GetFloat("FNumber")
+	assert.NoError(err)
+	assert.Equal(2.2, fnumber)
+
+	flash, err := meta.GetBool("Flash")
+	assert.NoError(err)
+	assert.False(flash)
+
+	_, err = meta.GetBool("Make")
+	assert.Error(err)
+
+	subjects, err := meta.GetStrings("Subject")
+	assert.NoError(err)
+	assert.Equal([]string{"cat", "garden", "2016"}, subjects)
+
+	makes, err := meta.GetStrings("Make")
+	assert.NoError(err)
+	assert.Equal([]string{"Apple"}, makes)
+
+	_, err = meta.GetString("Subject")
+	assert.Error(err)
+
+	thumb, err := meta.GetBytes("ThumbnailImage")
+	assert.NoError(err)
+	assert.Equal([]byte("hello"), thumb)
+
+	j, err := meta.MarshalJSON()
+	assert.NoError(err)
+	assert.Contains(string(j), `"EXIF:Make": "Apple"`)
+}
+
+func TestParseMetadataInvalid(t *testing.T) {
+	_, err := ParseMetadata([]byte(`{"SourceFile": "x"}`))
+	assert.Error(t, err)
+
+	_, err = ParseMetadata([]byte(`["x"]`))
+	assert.Error(t, err)
+}
+
+func TestExtractMetadata(t *testing.T) {
+	assert := assert.New(t)
+
+	meta, err := ExtractMetadata(context.Background(), "exiftool", "testdata/IMG_7238.JPG")
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal("image/jpeg", meta.MIMEType())
+
+	createDate, err := meta.GetString("CreateDate")
+	assert.NoError(err)
+	assert.Equal("2016:06:17 19:16:43", createDate)
+}
+
+func TestStayOpenExtractMetadata(t *testing.T) {
+	assert := assert.New(t)
+
+	stayopen, err := NewStayOpen("exiftool")
+	if !assert.NoError(err) {
+		return
+	}
+	defer stayopen.Stop()
+
+	meta, err := stayopen.ExtractMetadata(context.Background(), "testdata/IMG_7238.JPG", "-ShutterSpeed")
+	if !assert.NoError(err) {
+		return
+	}
+
+	ss, err := meta.GetString("ShutterSpeed")
+	assert.NoError(err)
+	assert.Equal("1/123", ss)
+	assert.False(meta.Has("CreateDate"))
+}
+
+func TestExtractMetadataKeepsFlags(t *testing.T) {
+	assert := assert.New(t)
+
+	stayopen, err := NewStayOpen("exiftool")
+	if !assert.NoError(err) {
+		return
+	}
+	defer stayopen.Stop()
+
+	pool, err := NewPool("exiftool", 1)
+	if !assert.NoError(err) {
+		return
+	}
+	defer pool.Stop()
+
+	// flags with room to spare may be shared with other goroutines so
+	// they mustn't be appended to in place
+	flags := make([]string, 1, 4)
+	flags[0] = "-ShutterSpeed"
+	for _, e := range []Extractor{stayopen, pool} {
+		_, err := e.ExtractMetadata(context.Background(), "testdata/IMG_7238.JPG", flags...)
+		assert.NoError(err)
+		assert.Equal([]string{"-ShutterSpeed", "", "", ""}, flags[:cap(flags)])
+	}
+}
+
+func TestExtractReaderKeepsFlags(t *testing.T) {
+	assert := assert.New(t)
+
+	stayopen, err := NewStayOpen("exiftool")
+	if !assert.NoError(err) {
+		return
+	}
+	defer stayopen.Stop()
+
+	pool, err := NewPool("exiftool", 1)
+	if !assert.NoError(err) {
+		return
+	}
+	defer pool.Stop()
+
+	ctx := context.Background()
+	extract := map[string]func(io.Reader, []string) error{
+		"ExtractReaderContext": func(r io.Reader, flags []string) error {
+			_, err := ExtractReaderContext(ctx, "exiftool", r, flags...)
+			return err
+		},
+		"ExtractReaderMetadata": func(r io.Reader, flags []string) error {
+			_, err := ExtractReaderMetadata(ctx, "exiftool", r, flags...)
+			return err
+		},
+		"Stayopen.ExtractReaderMetadata": func(r io.Reader, flags []string) error {
+			_, err := stayopen.ExtractReaderMetadata(ctx, r, flags...)
+			return err
+		},
+		"Pool.ExtractReaderMetadata": func(r io.Reader, flags []string) error {
+			_, err := pool.ExtractReaderMetadata(ctx, r, flags...)
+			return err
+		},
+	}
+
+	for name, fn := range extract {
+		f, err := os.Open("testdata/IMG_7238.JPG")
+		if !assert.NoError(err) {
+			return
+		}
+
+		flags := make([]string, 1, 4)
+		flags[0] = "-ShutterSpeed"
+		assert.NoError(fn(f, flags), name)
+		assert.Equal([]string{"-ShutterSpeed", "", "", ""}, flags[:cap(flags)], name)
+		f.Close()
+	}
+}
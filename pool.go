@@ -1,19 +1,123 @@
 package exiftool
 
 import (
+	"context"
+	"io"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
+// ErrQueueFull is returned by a Pool when MaxQueue requests are already
+// waiting for a worker
+var ErrQueueFull = errors.New("Pool queue is full")
+
+// Strategy decides which of a Pool's workers handles a request
+type Strategy int
+
+const (
+	// LeastBusy sends each request to an idle worker. When every worker is
+	// busy requests wait in a single queue and are handed to the next worker
+	// that finishes in the order they arrived.
+	LeastBusy Strategy = iota
+
+	// RoundRobin sends requests to each worker in turn, even if it is busy
+	RoundRobin
+)
+
+// PoolConfig configures a Pool created with NewPoolConfig
+type PoolConfig struct {
+	// Exiftool is the path to the exiftool executable
+	Exiftool string
+
+	// Binary is used instead of Exiftool when set, and is checked to be
+	// new enough for stay_open mode before any processes are started
+	Binary *Binary
+
+	// Flags are passed to exiftool with every request
+	Flags []string
+
+	// Size is the number of exiftool processes started by NewPoolConfig and
+	// the number kept running when the pool is idle
+	Size int
+
+	// MaxSize caps the number of exiftool processes. When it is larger
+	// than Size, processes are added while every worker is busy. Zero
+	// means Size, which keeps the pool at a fixed size.
+	MaxSize int
+
+	// IdleTimeout is how long a process above Size may go without a
+	// request before it is stopped. Zero means they are never stopped.
+	IdleTimeout time.Duration
+
+	Strategy Strategy
+
+	// MaxQueue limits how many requests may wait for a busy worker. More
+	// requests fail straight away with ErrQueueFull. Zero means no limit.
+	MaxQueue int
+
+	// Configure is called, if set, with each Stayopen the pool starts
+	// before it handles any requests, for example to set MaxRequests so
+	// the exiftool processes are recycled
+	Configure func(*Stayopen)
+
+	// Starter starts the exiftool processes. StartProcess is used when nil.
+	Starter Starter
+
+	// TempDir is where ExtractReader spools streams before it waits for a
+	// worker. The default directory for temporary files is used when empty.
+	TempDir string
+}
+
+// PoolStats is a snapshot of the work queued in a Pool
+type PoolStats struct {
+	// QueueDepths has an entry per worker with the number of requests it
+	// is running or that are waiting for it
+	QueueDepths []int
+
+	// Starting is the number of workers being added to the pool
+	Starting int
+
+	// Waiting is the number of requests waiting for any worker to become
+	// free, which only happens with LeastBusy
+	Waiting int
+}
+
 // Pool creates multiple stay open exiftool instances and spreads the work
-// across them with a simple round robin distribution.
+// across them using the configured Strategy
 type Pool struct {
 	sync.Mutex
-	stayopens []*Stayopen
-	c         int
-	l         int
-	stopped   bool
+	config  PoolConfig
+	workers []*worker
+	c       int
+	stopped bool
+
+	// waiting has a channel per request queued for the next free worker,
+	// oldest first
+	waiting []chan handoff
+
+	// starting counts workers being started outside the lock
+	starting int
+
+	// restarts of workers that were stopped for being idle
+	restarts int
+
+	// quit stops the goroutine that removes idle workers
+	quit chan struct{}
+}
+
+// worker is one of a Pool's Stayopen instances
+type worker struct {
+	stayopen *Stayopen
+
+	// depth counts the requests sent to the worker that haven't finished,
+	// including the one it is running
+	depth int
+
+	// idleSince is when depth last dropped to zero
+	idleSince time.Time
 }
 
 func (p *Pool) Extract(filename string) ([]byte, error) {
@@ -21,38 +125,433 @@ func (p *Pool) Extract(filename string) ([]byte, error) {
 }
 
 func (p *Pool) ExtractFlags(filename string, flags ...string) ([]byte, error) {
-	if p.stopped {
-		return nil, errors.New("Stopped")
+	return p.ExtractFlagsContext(context.Background(), filename, flags...)
+}
+
+// ExtractFlagsContext is like ExtractFlags but returns ctx.Err() if ctx is
+// done before the selected Stayopen returns a result
+func (p *Pool) ExtractFlagsContext(ctx context.Context, filename string, flags ...string) ([]byte, error) {
+	results, _, err := p.ExtractWarnings(ctx, filename, flags...)
+	return results, err
+}
+
+// ExtractWarnings is like ExtractFlagsContext but also returns the warnings
+// exiftool printed while processing the file
+func (p *Pool) ExtractWarnings(ctx context.Context, filename string, flags ...string) ([]byte, []Warning, error) {
+	s, done, err := p.acquire(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer done()
+	return s.ExtractWarnings(ctx, filename, flags...)
+}
+
+// ExtractReader is like Extract but reads the file from source. See
+// Stayopen.ExtractReader.
+func (p *Pool) ExtractReader(source io.Reader, flags ...string) ([]byte, error) {
+	return p.ExtractReaderContext(context.Background(), source, flags...)
+}
+
+// ExtractReaderContext is like ExtractReader but returns ctx.Err() if ctx is
+// done before the selected Stayopen returns a result
+func (p *Pool) ExtractReaderContext(ctx context.Context, source io.Reader, flags ...string) ([]byte, error) {
+	results, _, err := p.ExtractReaderWarnings(ctx, source, flags...)
+	return results, err
+}
+
+// ExtractReaderWarnings is like ExtractWarnings but reads the file from
+// source. source is copied to a temporary file in TempDir before a worker
+// is taken, so a slow stream doesn't hold one up.
+func (p *Pool) ExtractReaderWarnings(ctx context.Context, source io.Reader, flags ...string) ([]byte, []Warning, error) {
+	filename, err := spool(ctx, p.config.TempDir, source)
+	if err != nil {
+		return nil, nil, err
 	}
+	defer os.Remove(filename)
+
+	return p.ExtractWarnings(ctx, filename, flags...)
+}
+
+// acquire picks the Stayopen to send a request to, adding a worker or
+// waiting for one to become free if they are all busy. done must be called
+// once the request is finished.
+func (p *Pool) acquire(ctx context.Context) (s *Stayopen, done func(), err error) {
 	p.Lock()
-	p.c++
-	key := p.c % p.l
+	for {
+		if p.stopped {
+			p.Unlock()
+			return nil, nil, ErrStopped
+		}
+
+		if w := p.pick(); w != nil {
+			if w.depth > 0 && p.config.MaxQueue > 0 && p.queued() >= p.config.MaxQueue {
+				p.Unlock()
+				return nil, nil, ErrQueueFull
+			}
+			w.depth++
+			p.Unlock()
+			return w.stayopen, func() { p.release(w) }, nil
+		}
+
+		if len(p.workers)+p.starting >= p.maxSize() {
+			break
+		}
+
+		w, err := p.grow()
+		if err == nil {
+			w.depth++
+			p.Unlock()
+			return w.stayopen, func() { p.release(w) }, nil
+		}
+		if p.stopped || err == ErrStopped {
+			// Close ran while the worker was starting and has already
+			// failed the waiting requests
+			p.Unlock()
+			return nil, nil, ErrStopped
+		}
+		if len(p.workers) == 0 && p.starting == 0 {
+			// no worker will become free for the requests queued behind
+			// this one either
+			p.fail(err)
+			p.Unlock()
+			return nil, nil, err
+		}
+
+		// wait for one of the other workers instead
+		break
+	}
+
+	if p.config.MaxQueue > 0 && p.queued() >= p.config.MaxQueue {
+		p.Unlock()
+		return nil, nil, ErrQueueFull
+	}
+
+	ready := make(chan handoff, 1)
+	p.waiting = append(p.waiting, ready)
 	p.Unlock()
-	return p.stayopens[key].ExtractFlags(filename, flags...)
+
+	select {
+	case h := <-ready:
+		if h.err != nil {
+			return nil, nil, h.err
+		}
+		return h.w.stayopen, func() { p.release(h.w) }, nil
+	case <-ctx.Done():
+		p.Lock()
+		queued := p.dequeue(ready)
+		p.Unlock()
+
+		// a worker may have been handed over just as ctx was done
+		if !queued {
+			if h := <-ready; h.w != nil {
+				p.release(h.w)
+			}
+		}
+		return nil, nil, ctx.Err()
+	}
 }
 
-func (p *Pool) Stop() {
+// handoff is what a waiting request receives: the worker to use, or the
+// error to fail with when no worker will become free
+type handoff struct {
+	w   *worker
+	err error
+}
+
+// fail hands err to every waiting request
+func (p *Pool) fail(err error) {
+	for _, ready := range p.waiting {
+		ready <- handoff{err: err}
+	}
+	p.waiting = nil
+}
+
+// pick chooses a worker using the strategy. It returns nil when the pool
+// should grow or the request has to wait.
+func (p *Pool) pick() *worker {
+	if len(p.workers) == 0 {
+		return nil
+	}
+
+	if p.config.Strategy == RoundRobin {
+		p.c++
+		w := p.workers[p.c%len(p.workers)]
+		if w.depth > 0 && len(p.workers)+p.starting < p.maxSize() {
+			return nil
+		}
+		return w
+	}
+
+	for _, w := range p.workers {
+		if w.depth == 0 {
+			return w
+		}
+	}
+	return nil
+}
+
+// grow starts a new worker. The lock is released while the exiftool
+// process starts so requests can carry on using the other workers.
+func (p *Pool) grow() (*worker, error) {
+	p.starting++
+	p.Unlock()
+	s, err := p.newStayOpen()
+	p.Lock()
+	p.starting--
+
+	if err != nil {
+		return nil, err
+	}
+	if p.stopped {
+		s.Stop()
+		return nil, ErrStopped
+	}
+
+	w := &worker{stayopen: s, idleSince: time.Now()}
+	p.workers = append(p.workers, w)
+	return w, nil
+}
+
+func (p *Pool) newStayOpen() (*Stayopen, error) {
+	start := p.config.Starter
+	if start == nil {
+		start = StartProcess
+	}
+
+	s, err := NewStayOpenStarter(start, p.config.Exiftool, p.config.Flags...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not create StayOpen")
+	}
+	if p.config.Configure != nil {
+		p.config.Configure(s)
+	}
+	return s, nil
+}
+
+func (p *Pool) maxSize() int {
+	if p.config.MaxSize > 0 {
+		return p.config.MaxSize
+	}
+	return p.config.Size
+}
+
+// release hands w to the oldest waiting request or records that it has one
+// less request to run
+func (p *Pool) release(w *worker) {
 	p.Lock()
 	defer p.Unlock()
-	for _, s := range p.stayopens {
+
+	if len(p.waiting) > 0 {
+		ready := p.waiting[0]
+		p.waiting = p.waiting[1:]
+		ready <- handoff{w: w}
+		return
+	}
+
+	w.depth--
+	if w.depth == 0 {
+		w.idleSince = time.Now()
+	}
+}
+
+// shrink stops workers above the pool's Size that have been idle for
+// longer than IdleTimeout
+func (p *Pool) shrink(now time.Time) {
+	var idle []*Stayopen
+
+	p.Lock()
+	if p.stopped {
+		// Close is stopping every worker
+		p.Unlock()
+		return
+	}
+	workers := p.workers[:0]
+	for _, w := range p.workers {
+		if len(p.workers)-len(idle) > p.config.Size && w.depth == 0 && now.Sub(w.idleSince) >= p.config.IdleTimeout {
+			idle = append(idle, w.stayopen)
+			continue
+		}
+		workers = append(workers, w)
+	}
+	for i := len(workers); i < len(p.workers); i++ {
+		p.workers[i] = nil
+	}
+	p.workers = workers
+	p.Unlock()
+
+	for _, s := range idle {
+		restarts := s.Restarts()
 		s.Stop()
+
+		p.Lock()
+		p.restarts += restarts
+		p.Unlock()
+	}
+}
+
+// reap calls shrink until the pool is stopped
+func (p *Pool) reap() {
+	interval := p.config.IdleTimeout / 2
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			p.shrink(now)
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// dequeue removes a waiting request. It returns false if the request was
+// already handed a worker.
+func (p *Pool) dequeue(ready chan handoff) bool {
+	for i, c := range p.waiting {
+		if c == ready {
+			p.waiting = append(p.waiting[:i], p.waiting[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// queued counts the requests waiting behind the ones the workers are
+// running
+func (p *Pool) queued() int {
+	n := len(p.waiting)
+	for _, w := range p.workers {
+		if w.depth > 1 {
+			n += w.depth - 1
+		}
+	}
+	return n
+}
+
+// Stats returns how many requests are queued for each worker
+func (p *Pool) Stats() PoolStats {
+	p.Lock()
+	defer p.Unlock()
+
+	stats := PoolStats{
+		QueueDepths: make([]int, len(p.workers)),
+		Waiting:     len(p.waiting),
+		Starting:    p.starting,
+	}
+	for i, w := range p.workers {
+		stats.QueueDepths[i] = w.depth
+	}
+	return stats
+}
+
+// Restarts returns how many times exited exiftool processes were replaced
+// across all of the pool's Stayopen instances
+func (p *Pool) Restarts() int {
+	p.Lock()
+	total := p.restarts
+	workers := append([]*worker(nil), p.workers...)
+	p.Unlock()
+
+	// the workers are counted without the lock so a slow one can't hold
+	// up other requests
+	for _, w := range workers {
+		total += w.stayopen.Restarts()
+	}
+	return total
+}
+
+// Stop is like Close but gives each exiftool process a few seconds to exit
+// and ignores any errors
+func (p *Pool) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+	defer cancel()
+	p.Close(ctx)
+}
+
+// Close stops the pool from taking new requests, fails those waiting for a
+// worker and closes every Stayopen at the same time. See Stayopen.Close.
+// The errors from the workers are returned together as Errors.
+func (p *Pool) Close(ctx context.Context) error {
+	p.Lock()
+	if p.stopped {
+		p.Unlock()
+		return ErrStopped
 	}
 	p.stopped = true
+
+	p.fail(ErrStopped)
+	if p.quit != nil {
+		close(p.quit)
+	}
+	workers := append([]*worker(nil), p.workers...)
+	p.Unlock()
+
+	errs := make([]error, len(workers))
+	var wg sync.WaitGroup
+	for i, w := range workers {
+		wg.Add(1)
+		go func(i int, s *Stayopen) {
+			defer wg.Done()
+			errs[i] = s.Close(ctx)
+		}(i, w.stayopen)
+	}
+	wg.Wait()
+
+	var failed Errors
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
 }
 
 // NewPool creates a *Pool with default flags to pass to every Extract call
 func NewPool(exiftool string, num int, flags ...string) (*Pool, error) {
-	p := &Pool{
-		stayopens: make([]*Stayopen, num, num),
-		l:         num,
+	return NewPoolConfig(PoolConfig{
+		Exiftool: exiftool,
+		Flags:    flags,
+		Size:     num,
+	})
+}
+
+// NewPoolConfig creates a *Pool and starts its first Size exiftool
+// processes
+func NewPoolConfig(config PoolConfig) (*Pool, error) {
+	if config.MaxSize == 0 && config.Size < 1 {
+		return nil, errors.New("Pool size must be at least 1")
+	}
+	if config.MaxSize > 0 && (config.Size < 0 || config.Size > config.MaxSize) {
+		return nil, errors.New("Pool size must be between 0 and MaxSize")
+	}
+	if config.Binary != nil {
+		if err := config.Binary.Require("-echo4"); err != nil {
+			return nil, err
+		}
+		config.Exiftool = config.Binary.Path
 	}
 
-	var err error
-	for i := 0; i < num; i++ {
-		p.stayopens[i], err = NewStayOpen(exiftool, flags...)
+	p := &Pool{config: config}
+	for i := 0; i < config.Size; i++ {
+		s, err := p.newStayOpen()
 		if err != nil {
-			return nil, errors.Wrap(err, "Could not create StayOpen")
+			p.Stop()
+			return nil, err
 		}
+		p.workers = append(p.workers, &worker{stayopen: s, idleSince: time.Now()})
+	}
+
+	if config.IdleTimeout > 0 && p.maxSize() > config.Size {
+		p.quit = make(chan struct{})
+		go p.reap()
 	}
 
 	return p, nil
@@ -1,9 +1,14 @@
 package exiftool
 
 import (
+	"context"
+	"os"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/buger/jsonparser"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -50,3 +55,439 @@ func TestPoolErrorsOnBadBin(t *testing.T) {
 	_, err := NewPool("not.a.rea.bin", 1)
 	assert.Error(t, err)
 }
+
+func TestPoolExtractReaderMetadata(t *testing.T) {
+	assert := assert.New(t)
+
+	pool, err := NewPool("exiftool", 2)
+	if !assert.NoError(err) {
+		return
+	}
+	defer pool.Stop()
+
+	for i := 0; i < 4; i++ {
+		f, err := os.Open("testdata/IMG_7238.JPG")
+		if !assert.NoError(err) {
+			return
+		}
+
+		meta, err := pool.ExtractReaderMetadata(context.Background(), f, "-fast")
+		f.Close()
+		if assert.NoError(err) {
+			ss, err := meta.GetString("ShutterSpeed")
+			assert.NoError(err)
+			assert.Equal("1/123", ss)
+		}
+	}
+}
+
+// newTestPool creates a Pool with workers that have no exiftool process, for
+// testing scheduling
+func newTestPool(config PoolConfig) *Pool {
+	p := &Pool{config: config}
+	for i := 0; i < config.Size; i++ {
+		p.workers = append(p.workers, &worker{stayopen: &Stayopen{}})
+	}
+	return p
+}
+
+func TestPoolLeastBusy(t *testing.T) {
+	assert := assert.New(t)
+
+	p := newTestPool(PoolConfig{Size: 2, MaxQueue: 1})
+	ctx := context.Background()
+
+	s1, done1, err := p.acquire(ctx)
+	assert.NoError(err)
+	s2, done2, err := p.acquire(ctx)
+	assert.NoError(err)
+	assert.True(s1 != s2, "both workers should be used")
+
+	// the third request waits for the first worker to finish
+	third := make(chan *Stayopen)
+	go func() {
+		s, done, err := p.acquire(ctx)
+		assert.NoError(err)
+		third <- s
+		done()
+	}()
+
+	for p.Stats().Waiting == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	_, _, err = p.acquire(ctx)
+	assert.Equal(ErrQueueFull, err)
+	assert.Equal(PoolStats{QueueDepths: []int{1, 1}, Waiting: 1}, p.Stats())
+
+	done1()
+	assert.True(s1 == <-third)
+
+	done2()
+	for p.Stats().QueueDepths[0] != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(PoolStats{QueueDepths: []int{0, 0}}, p.Stats())
+}
+
+func TestPoolLeastBusyCanceled(t *testing.T) {
+	assert := assert.New(t)
+
+	p := newTestPool(PoolConfig{Size: 1})
+	_, done, err := p.acquire(context.Background())
+	assert.NoError(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, _, err = p.acquire(ctx)
+	assert.Equal(context.DeadlineExceeded, err)
+	assert.Equal(0, p.Stats().Waiting)
+
+	done()
+	assert.Equal([]int{0}, p.Stats().QueueDepths)
+}
+
+func TestPoolRoundRobin(t *testing.T) {
+	assert := assert.New(t)
+
+	p := newTestPool(PoolConfig{Size: 2, Strategy: RoundRobin, MaxQueue: 1})
+	ctx := context.Background()
+
+	var dones []func()
+	for i := 0; i < 3; i++ {
+		_, done, err := p.acquire(ctx)
+		if !assert.NoError(err) {
+			return
+		}
+		dones = append(dones, done)
+	}
+
+	// the third request is queued behind a busy worker
+	assert.Equal([]int{1, 2}, p.Stats().QueueDepths)
+	_, _, err := p.acquire(ctx)
+	assert.Equal(ErrQueueFull, err)
+
+	for _, done := range dones {
+		done()
+	}
+	assert.Equal([]int{0, 0}, p.Stats().QueueDepths)
+}
+
+func TestNewPoolConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	configured := 0
+	pool, err := NewPoolConfig(PoolConfig{
+		Exiftool:  "exiftool",
+		Size:      2,
+		Strategy:  RoundRobin,
+		Configure: func(s *Stayopen) { configured++ },
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer pool.Stop()
+
+	assert.Equal(2, configured)
+
+	meta, err := pool.ExtractMetadata(context.Background(), "testdata/IMG_7238.JPG")
+	if assert.NoError(err) {
+		assert.Equal("image/jpeg", meta.MIMEType())
+	}
+
+	_, err = NewPoolConfig(PoolConfig{Exiftool: "exiftool"})
+	assert.Error(err)
+}
+
+func TestPoolGrowAndShrink(t *testing.T) {
+	assert := assert.New(t)
+
+	pool, err := NewPoolConfig(PoolConfig{
+		Exiftool:    "exiftool",
+		Size:        1,
+		MaxSize:     3,
+		IdleTimeout: 50 * time.Millisecond,
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer pool.Stop()
+
+	assert.Len(pool.Stats().QueueDepths, 1)
+
+	// workers are added while all of them are busy, up to MaxSize
+	ctx := context.Background()
+	var dones []func()
+	for i := 0; i < 3; i++ {
+		s, done, err := pool.acquire(ctx)
+		if !assert.NoError(err) {
+			return
+		}
+		dones = append(dones, done)
+
+		_, err = s.ExtractMetadata(ctx, "testdata/IMG_7238.JPG")
+		assert.NoError(err)
+	}
+	assert.Equal([]int{1, 1, 1}, pool.Stats().QueueDepths)
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	_, _, err = pool.acquire(ctx)
+	cancel()
+	assert.Equal(context.DeadlineExceeded, err)
+
+	for _, done := range dones {
+		done()
+	}
+
+	// idle workers above Size are stopped
+	deadline := time.Now().Add(5 * time.Second)
+	for len(pool.Stats().QueueDepths) > 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal([]int{0}, pool.Stats().QueueDepths)
+
+	_, err = pool.ExtractMetadata(context.Background(), "testdata/IMG_7238.JPG")
+	assert.NoError(err)
+}
+
+func TestPoolShrinkAfterClose(t *testing.T) {
+	assert := assert.New(t)
+
+	pool, err := NewPoolConfig(PoolConfig{
+		Exiftool:    "exiftool",
+		Size:        1,
+		MaxSize:     2,
+		IdleTimeout: time.Hour,
+	})
+	if !assert.NoError(err) {
+		return
+	}
+
+	ctx := context.Background()
+	var dones []func()
+	for i := 0; i < 2; i++ {
+		_, done, err := pool.acquire(ctx)
+		if !assert.NoError(err) {
+			return
+		}
+		dones = append(dones, done)
+	}
+	for _, done := range dones {
+		done()
+	}
+
+	// the reaper wakes up after Close has taken the workers to stop
+	pool.Lock()
+	pool.stopped = true
+	pool.Unlock()
+	pool.shrink(time.Now().Add(2 * time.Hour))
+	assert.Len(pool.Stats().QueueDepths, 2)
+
+	pool.Lock()
+	pool.stopped = false
+	pool.Unlock()
+	assert.NoError(pool.Close(ctx))
+}
+
+func TestPoolStartsLazily(t *testing.T) {
+	assert := assert.New(t)
+
+	pool, err := NewPoolConfig(PoolConfig{Exiftool: "exiftool", MaxSize: 2})
+	if !assert.NoError(err) {
+		return
+	}
+	defer pool.Stop()
+
+	assert.Empty(pool.Stats().QueueDepths)
+
+	_, err = pool.ExtractMetadata(context.Background(), "testdata/IMG_7238.JPG")
+	assert.NoError(err)
+	assert.Len(pool.Stats().QueueDepths, 1)
+
+	_, err = NewPoolConfig(PoolConfig{Exiftool: "exiftool", Size: 3, MaxSize: 2})
+	assert.Error(err)
+
+	lazy, err := NewPoolConfig(PoolConfig{Exiftool: "not.a.rea.bin", MaxSize: 1})
+	if assert.NoError(err) {
+		_, err = lazy.ExtractMetadata(context.Background(), "testdata/IMG_7238.JPG")
+		assert.Error(err)
+		lazy.Stop()
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	assert := assert.New(t)
+
+	pool, err := NewPool("exiftool", 2)
+	if !assert.NoError(err) {
+		return
+	}
+
+	_, err = pool.ExtractMetadata(context.Background(), "testdata/IMG_7238.JPG")
+	assert.NoError(err)
+
+	assert.NoError(pool.Close(context.Background()))
+	for _, w := range pool.workers {
+		assert.Nil(w.stayopen.cmd)
+	}
+
+	_, err = pool.Extract("testdata/IMG_7238.JPG")
+	assert.Equal(ErrStopped, err)
+	assert.Equal(ErrStopped, pool.Close(context.Background()))
+}
+
+func TestPoolCloseFailsWaiting(t *testing.T) {
+	p := newTestPool(PoolConfig{Size: 1})
+	_, _, err := p.acquire(context.Background())
+	assert.NoError(t, err)
+
+	waiting := make(chan error)
+	go func() {
+		_, _, err := p.acquire(context.Background())
+		waiting <- err
+	}()
+	for p.Stats().Waiting == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	p.Lock()
+	p.workers = nil // the test workers have no process to close
+	p.Unlock()
+	assert.NoError(t, p.Close(context.Background()))
+	assert.Equal(t, ErrStopped, <-waiting)
+}
+
+func TestPoolRestartsDuringRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	pool, err := NewPool("exiftool", 2)
+	if !assert.NoError(err) {
+		return
+	}
+	defer pool.Stop()
+
+	// hold the first worker as if it were handling a slow request
+	s := pool.workers[0].stayopen
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	restarts := make(chan int)
+	go func() {
+		restarts <- pool.Restarts()
+	}()
+	select {
+	case n := <-restarts:
+		assert.Equal(0, n)
+	case <-time.After(time.Second):
+		t.Fatal("Restarts waited for the request in flight")
+	}
+
+	stats := make(chan PoolStats)
+	go func() {
+		stats <- pool.Stats()
+	}()
+	select {
+	case <-stats:
+	case <-time.After(time.Second):
+		t.Fatal("Stats waited for the request in flight")
+	}
+}
+
+func TestPoolCloseWhileStarting(t *testing.T) {
+	assert := assert.New(t)
+
+	// the second process doesn't start until the gate is opened
+	gate := make(chan struct{})
+	starts := 0
+	var mu sync.Mutex
+	start := func(exiftool string, args ...string) (Process, error) {
+		mu.Lock()
+		starts++
+		n := starts
+		mu.Unlock()
+		if n > 1 {
+			<-gate
+		}
+		return StartProcess(exiftool, args...)
+	}
+
+	pool, err := NewPoolConfig(PoolConfig{Exiftool: "exiftool", Size: 1, MaxSize: 2, Starter: start})
+	if !assert.NoError(err) {
+		return
+	}
+
+	ctx := context.Background()
+	_, done, err := pool.acquire(ctx)
+	if !assert.NoError(err) {
+		return
+	}
+
+	acquired := make(chan error)
+	go func() {
+		_, _, err := pool.acquire(ctx)
+		acquired <- err
+	}()
+	for pool.Stats().Starting == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the first worker is idle when the pool is closed
+	done()
+	assert.NoError(pool.Close(ctx))
+	close(gate)
+
+	select {
+	case err := <-acquired:
+		assert.Equal(ErrStopped, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("request started during Close never returned")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	err := Errors{errors.New("a"), errors.New("b")}
+	assert.Equal(t, "a; b", err.Error())
+}
+
+func TestPoolStartFailsWaiting(t *testing.T) {
+	assert := assert.New(t)
+
+	gate := make(chan struct{})
+	start := func(exiftool string, args ...string) (Process, error) {
+		<-gate
+		return nil, errors.New("no exiftool")
+	}
+	pool, err := NewPoolConfig(PoolConfig{Size: 0, MaxSize: 1, Starter: start})
+	if !assert.NoError(err) {
+		return
+	}
+	defer pool.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	errs := make(chan error, 2)
+	go func() {
+		_, err := pool.ExtractMetadata(ctx, "a.jpg")
+		errs <- err
+	}()
+	for pool.Stats().Starting == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	go func() {
+		_, err := pool.ExtractMetadata(ctx, "b.jpg")
+		errs <- err
+	}()
+	for pool.Stats().Waiting == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(gate)
+
+	// the queued request fails with the start error rather than its deadline
+	for i := 0; i < 2; i++ {
+		err := <-errs
+		if assert.Error(err) {
+			assert.Contains(err.Error(), "no exiftool")
+		}
+	}
+}
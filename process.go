@@ -0,0 +1,76 @@
+package exiftool
+
+import (
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// Process is a running exiftool that a Stayopen talks to over its standard
+// streams. Processes are started by a Starter.
+type Process interface {
+	Stdin() io.WriteCloser
+	Stdout() io.Reader
+	Stderr() io.Reader
+
+	// Signal and Kill stop the process. Signal may return an error for
+	// signals that aren't supported, in which case Kill is used.
+	Signal(sig os.Signal) error
+	Kill() error
+
+	// Wait waits for the process to exit, after stdout and stderr reach
+	// EOF, and returns why it exited
+	Wait() error
+}
+
+// Starter starts exiftool with args. StartProcess is used unless a Stayopen
+// is created with NewStayOpenStarter, which lets tests run a fake exiftool
+// without a separate binary.
+type Starter func(exiftool string, args ...string) (Process, error)
+
+// StartProcess runs exiftool as an operating system process
+func StartProcess(exiftool string, args ...string) (Process, error) {
+	cmd := exec.Command(exiftool, args...)
+	p := &execProcess{cmd: cmd}
+
+	var err error
+	if p.stdin, err = cmd.StdinPipe(); err != nil {
+		return nil, errors.Wrap(err, "Failed getting stdin pipe")
+	}
+	if p.stdout, err = cmd.StdoutPipe(); err != nil {
+		return nil, errors.Wrap(err, "Failed getting stdout pipe")
+	}
+	if p.stderr, err = cmd.StderrPipe(); err != nil {
+		return nil, errors.Wrap(err, "Failed getting stderr pipe")
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+type execProcess struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.Reader
+	stderr io.Reader
+}
+
+func (p *execProcess) Stdin() io.WriteCloser      { return p.stdin }
+func (p *execProcess) Stdout() io.Reader          { return p.stdout }
+func (p *execProcess) Stderr() io.Reader          { return p.stderr }
+func (p *execProcess) Signal(sig os.Signal) error { return p.cmd.Process.Signal(sig) }
+func (p *execProcess) Kill() error                { return p.cmd.Process.Kill() }
+func (p *execProcess) Wait() error                { return p.cmd.Wait() }
+
+// pid returns the operating system process id of p, or 0 if p isn't an
+// operating system process
+func pid(p Process) int {
+	if e, ok := p.(*execProcess); ok {
+		return e.cmd.Process.Pid
+	}
+	return 0
+}
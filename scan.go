@@ -0,0 +1,430 @@
+package exiftool
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SymlinkPolicy decides which symbolic links Scan follows
+type SymlinkPolicy int
+
+const (
+	// SkipSymlinks ignores symbolic links
+	SkipSymlinks SymlinkPolicy = iota
+
+	// FollowFileSymlinks scans the files links point to but doesn't
+	// descend into linked directories
+	FollowFileSymlinks
+
+	// FollowSymlinks follows every link. Directories reached more than
+	// once, such as through a link to a parent, are only scanned the
+	// first time.
+	FollowSymlinks
+)
+
+// ScanOptions configures Scan. The zero value extracts nothing and lists
+// every file below the root.
+type ScanOptions struct {
+	// Extractor extracts the metadata of each file, usually a *Pool. When
+	// nil the files are listed without being extracted.
+	Extractor Extractor
+
+	// Flags are passed to the Extractor for every file
+	Flags []string
+
+	// Workers is the number of files extracted at the same time and of
+	// directories read at the same time. Zero means the MaxSize of a *Pool
+	// Extractor or else the number of CPUs.
+	Workers int
+
+	// Include and Exclude are path.Match patterns. Patterns containing a /
+	// are matched against the path relative to the root, with / between
+	// directories, and others against the base name. Files must match one
+	// of Include, if given, and none of Exclude. Directories matching
+	// Exclude aren't descended into.
+	Include []string
+	Exclude []string
+
+	// Extensions limits the files to those with one of the extensions, such
+	// as ".jpg" or "CR2", compared without regard to case
+	Extensions []string
+
+	// MIMETypes limits the files to those whose type, as guessed by
+	// SniffMIMEType before calling the Extractor, is one of these. A type
+	// may end in /* to match every subtype, such as image/*.
+	MIMETypes []string
+
+	Symlinks SymlinkPolicy
+
+	// MaxDepth limits how deep the scan goes. Files in the root are at a
+	// depth of 1. Zero means no limit.
+	MaxDepth int
+}
+
+// ScanResult is the outcome of scanning one file. A directory that can't be
+// read or a broken symbolic link is also reported as a ScanResult with Err
+// set.
+type ScanResult struct {
+	Filename string
+
+	// Metadata is nil when Err is set or there is no Extractor
+	Metadata *Metadata
+
+	Err error
+}
+
+// ScanProgress is a snapshot of a Scanner's work
+type ScanProgress struct {
+	// Found is the number of files that matched the filters on their name
+	Found int64
+
+	// Skipped is the number of files found that didn't match MIMETypes
+	Skipped int64
+
+	// Processed is the number of files extracted, whether or not it
+	// succeeded
+	Processed int64
+
+	// Failed is the number of files that couldn't be extracted plus the
+	// directories and links that couldn't be read
+	Failed int64
+
+	// Bytes is the size of the files found, less those skipped, and
+	// ProcessedBytes the size of those processed
+	Bytes          int64
+	ProcessedBytes int64
+
+	Elapsed time.Duration
+
+	// Walking is true until every directory has been read
+	Walking bool
+}
+
+// ETA estimates how much longer the scan will take from the rate files have
+// been processed so far. It is zero until the first file has been
+// processed, and too low while Walking as more files may be found.
+func (p ScanProgress) ETA() time.Duration {
+	done, total := float64(p.ProcessedBytes), float64(p.Bytes)
+	if total == 0 {
+		done, total = float64(p.Processed+p.Skipped), float64(p.Found)
+	}
+	if done == 0 {
+		return 0
+	}
+	return time.Duration(float64(p.Elapsed) * (total - done) / done)
+}
+
+// Scanner is a scan started by Scan
+type Scanner struct {
+	opts    ScanOptions
+	results chan ScanResult
+	files   chan scanFile
+
+	// walkers limits the directories read at once
+	walkers chan struct{}
+	walking sync.WaitGroup
+
+	mu       sync.Mutex
+	progress ScanProgress
+	start    time.Time
+	finished bool
+	err      error
+
+	// visited holds the real paths of the directories scanned when
+	// following symbolic links to directories
+	visited map[string]bool
+}
+
+type scanFile struct {
+	path string
+	size int64
+}
+
+// Scan walks the directory root, reading several directories at a time,
+// and extracts the metadata of the files that pass the filters in opts with
+// opts.Workers requests at a time. The results are sent to the Scanner's
+// Results channel in no particular order. The scan stops early when ctx is
+// done.
+func Scan(ctx context.Context, root string, opts ScanOptions) (*Scanner, error) {
+	for _, p := range append(opts.Include[:len(opts.Include):len(opts.Include)], opts.Exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, errors.Wrapf(err, "Invalid pattern %q", p)
+		}
+	}
+
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not read scan root")
+	}
+	if !info.IsDir() {
+		return nil, errors.New("Scan root is not a directory")
+	}
+
+	workers := opts.Workers
+	if workers < 1 {
+		workers = runtime.NumCPU()
+		if p, ok := opts.Extractor.(*Pool); ok {
+			workers = p.maxSize()
+		}
+	}
+
+	extensions := make([]string, len(opts.Extensions))
+	for i, ext := range opts.Extensions {
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		extensions[i] = strings.ToLower(ext)
+	}
+	opts.Extensions = extensions
+
+	s := &Scanner{
+		opts:    opts,
+		results: make(chan ScanResult, workers),
+		files:   make(chan scanFile, workers),
+		walkers: make(chan struct{}, workers),
+		start:   time.Now(),
+		visited: make(map[string]bool),
+	}
+	s.progress.Walking = true
+	s.visit(root)
+
+	s.walking.Add(1)
+	go s.walkDir(ctx, root, "", 0)
+	go func() {
+		s.walking.Wait()
+		close(s.files)
+		s.mu.Lock()
+		s.progress.Walking = false
+		s.mu.Unlock()
+	}()
+
+	var extracting sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		extracting.Add(1)
+		go func() {
+			defer extracting.Done()
+			s.extract(ctx)
+		}()
+	}
+	go func() {
+		extracting.Wait()
+		s.mu.Lock()
+		s.progress.Elapsed = time.Since(s.start)
+		s.finished = true
+		s.err = ctx.Err()
+		s.mu.Unlock()
+		close(s.results)
+	}()
+
+	return s, nil
+}
+
+// Results returns the channel the results are sent to. It is closed when the
+// scan is finished or stopped. Results must be received until then or ctx
+// canceled, otherwise the scan blocks.
+func (s *Scanner) Results() <-chan ScanResult {
+	return s.results
+}
+
+// Progress returns a snapshot of the scan's work so far
+func (s *Scanner) Progress() ScanProgress {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.progress
+	if !s.finished {
+		p.Elapsed = time.Since(s.start)
+	}
+	return p
+}
+
+// Err returns the error of the ctx passed to Scan if the scan was stopped
+// early. It is only set once Results is closed.
+func (s *Scanner) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// walkDir reads dir, which is rel from the root and at depth, sending its
+// files to the workers and walking its subdirectories in new goroutines
+func (s *Scanner) walkDir(ctx context.Context, dir, rel string, depth int) {
+	defer s.walking.Done()
+
+	select {
+	case s.walkers <- struct{}{}:
+	case <-ctx.Done():
+		return
+	}
+	entries, err := ioutil.ReadDir(dir)
+	<-s.walkers
+	if err != nil {
+		s.fail(ctx, dir, errors.Wrap(err, "Could not read directory"))
+		return
+	}
+
+	for _, info := range entries {
+		if ctx.Err() != nil {
+			return
+		}
+
+		name := filepath.Join(dir, info.Name())
+		relName := path.Join(rel, info.Name())
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			if s.opts.Symlinks == SkipSymlinks {
+				continue
+			}
+			target, err := os.Stat(name)
+			if err != nil {
+				s.fail(ctx, name, errors.Wrap(err, "Could not follow symbolic link"))
+				continue
+			}
+			if target.IsDir() && s.opts.Symlinks != FollowSymlinks {
+				continue
+			}
+			info = target
+		}
+
+		switch {
+		case info.IsDir():
+			if (s.opts.MaxDepth > 0 && depth+1 >= s.opts.MaxDepth) || matchAny(s.opts.Exclude, relName) || !s.visit(name) {
+				continue
+			}
+			s.walking.Add(1)
+			go s.walkDir(ctx, name, relName, depth+1)
+
+		case info.Mode().IsRegular():
+			if !s.selected(relName) {
+				continue
+			}
+			s.mu.Lock()
+			s.progress.Found++
+			s.progress.Bytes += info.Size()
+			s.mu.Unlock()
+
+			select {
+			case s.files <- scanFile{name, info.Size()}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// visit returns false if dir has already been scanned through another
+// symbolic link
+func (s *Scanner) visit(dir string) bool {
+	if s.opts.Symlinks != FollowSymlinks {
+		return true
+	}
+
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		real = dir
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.visited[real] {
+		return false
+	}
+	s.visited[real] = true
+	return true
+}
+
+// selected returns true if the file rel from the root passes the filters on
+// its name
+func (s *Scanner) selected(rel string) bool {
+	if len(s.opts.Extensions) > 0 && !contains(s.opts.Extensions, strings.ToLower(path.Ext(rel))) {
+		return false
+	}
+	if len(s.opts.Include) > 0 && !matchAny(s.opts.Include, rel) {
+		return false
+	}
+	return !matchAny(s.opts.Exclude, rel)
+}
+
+// matchAny returns true if rel matches one of patterns. See
+// ScanOptions.Include.
+func matchAny(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		name := rel
+		if !strings.Contains(p, "/") {
+			name = path.Base(rel)
+		}
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// extract handles the files found until the walk is finished
+func (s *Scanner) extract(ctx context.Context) {
+	for f := range s.files {
+		if ctx.Err() != nil {
+			// drain the files so the walk can finish
+			continue
+		}
+
+		if len(s.opts.MIMETypes) > 0 {
+			mime, err := SniffMIMEType(f.path)
+			if err != nil {
+				s.processed(f, err)
+				s.send(ctx, ScanResult{Filename: f.path, Err: err})
+				continue
+			}
+			if !matchMIMEType(mime, s.opts.MIMETypes) {
+				s.mu.Lock()
+				s.progress.Skipped++
+				s.progress.Bytes -= f.size
+				s.mu.Unlock()
+				continue
+			}
+		}
+
+		result := ScanResult{Filename: f.path}
+		if s.opts.Extractor != nil {
+			result.Metadata, result.Err = s.opts.Extractor.ExtractMetadata(ctx, f.path, s.opts.Flags...)
+			if result.Err != nil && ctx.Err() != nil {
+				// the file wasn't processed, the scan was stopped
+				continue
+			}
+		}
+		s.processed(f, result.Err)
+		s.send(ctx, result)
+	}
+}
+
+func (s *Scanner) processed(f scanFile, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.progress.Processed++
+	s.progress.ProcessedBytes += f.size
+	if err != nil {
+		s.progress.Failed++
+	}
+}
+
+// fail reports a directory or link that couldn't be read
+func (s *Scanner) fail(ctx context.Context, name string, err error) {
+	s.mu.Lock()
+	s.progress.Failed++
+	s.mu.Unlock()
+	s.send(ctx, ScanResult{Filename: name, Err: err})
+}
+
+func (s *Scanner) send(ctx context.Context, r ScanResult) {
+	select {
+	case s.results <- r:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,207 @@
+package exiftool
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// scanTree creates files, with their contents, in a new directory
+func scanTree(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "go-exiftool")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// scanAll returns the names of the files scanned, relative to root, and
+// the errors
+func scanAll(t *testing.T, root string, opts ScanOptions) ([]string, map[string]error, *Scanner) {
+	s, err := Scan(context.Background(), root, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	errs := make(map[string]error)
+	for r := range s.Results() {
+		rel, _ := filepath.Rel(root, r.Filename)
+		rel = filepath.ToSlash(rel)
+		if r.Err != nil {
+			errs[rel] = r.Err
+			continue
+		}
+		names = append(names, rel)
+	}
+	sort.Strings(names)
+	return names, errs, s
+}
+
+const jpegData = "\xff\xd8\xff\xe0\x00\x10JFIF\x00"
+
+func TestScan(t *testing.T) {
+	assert := assert.New(t)
+
+	root := scanTree(t, map[string]string{
+		"a.jpg":            jpegData,
+		"b.JPG":            jpegData,
+		"notes.txt":        "notes",
+		"raw/c.cr2":        "II*\x00\x10\x00\x00\x00CR\x02\x00",
+		"raw/deep/d.jpg":   jpegData,
+		"skip/e.jpg":       jpegData,
+		"mislabelled.jpg":  "not a jpeg",
+		".thumbs/f.jpg":    jpegData,
+		"raw/deep/g.jpeg":  jpegData,
+		"raw/deep/h.thumb": jpegData,
+	})
+	defer os.RemoveAll(root)
+
+	e := &countingExtractor{}
+	names, errs, s := scanAll(t, root, ScanOptions{Extractor: e})
+	assert.Len(names, 10)
+	assert.Empty(errs)
+	assert.Equal(10, e.count())
+
+	progress := s.Progress()
+	assert.Equal(int64(10), progress.Found)
+	assert.Equal(int64(10), progress.Processed)
+	assert.Equal(int64(0), progress.Failed)
+	assert.Equal(progress.Bytes, progress.ProcessedBytes)
+	assert.False(progress.Walking)
+	assert.Equal(time.Duration(0), progress.ETA())
+	assert.NoError(s.Err())
+
+	names, _, _ = scanAll(t, root, ScanOptions{
+		Extensions: []string{"jpg", ".CR2"},
+		Exclude:    []string{"skip", ".*", "raw/deep/*"},
+	})
+	assert.Equal([]string{"a.jpg", "b.JPG", "mislabelled.jpg", "raw/c.cr2"}, names)
+
+	names, _, _ = scanAll(t, root, ScanOptions{Include: []string{"*.jpg", "raw/*/*"}, MaxDepth: 2})
+	assert.Equal([]string{".thumbs/f.jpg", "a.jpg", "mislabelled.jpg", "skip/e.jpg"}, names)
+
+	// sniffing skips files that aren't images whatever their name
+	names, _, s = scanAll(t, root, ScanOptions{Extractor: e, MIMETypes: []string{"image/*"}})
+	assert.Equal([]string{".thumbs/f.jpg", "a.jpg", "b.JPG", "raw/c.cr2", "raw/deep/d.jpg",
+		"raw/deep/g.jpeg", "raw/deep/h.thumb", "skip/e.jpg"}, names)
+	assert.Equal(int64(2), s.Progress().Skipped)
+	assert.Equal(18, e.count())
+
+	_, err := Scan(context.Background(), root, ScanOptions{Include: []string{"["}})
+	assert.Error(err)
+	_, err = Scan(context.Background(), filepath.Join(root, "a.jpg"), ScanOptions{})
+	assert.Error(err)
+}
+
+func TestScanSymlinks(t *testing.T) {
+	assert := assert.New(t)
+
+	root := scanTree(t, map[string]string{
+		"photos/a.jpg": jpegData,
+		"other/b.jpg":  jpegData,
+	})
+	defer os.RemoveAll(root)
+
+	links := map[string]string{
+		"photos/link.jpg": "a.jpg",
+		"photos/broken":   "missing.jpg",
+		"photos/other":    "../other",
+		"photos/loop":     "..",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, filepath.FromSlash(name))); err != nil {
+			t.Skip("symbolic links aren't supported:", err)
+		}
+	}
+
+	names, errs, _ := scanAll(t, root, ScanOptions{})
+	assert.Equal([]string{"other/b.jpg", "photos/a.jpg"}, names)
+	assert.Empty(errs)
+
+	names, errs, _ = scanAll(t, root, ScanOptions{Symlinks: FollowFileSymlinks})
+	assert.Equal([]string{"other/b.jpg", "photos/a.jpg", "photos/link.jpg"}, names)
+	assert.Contains(errs, "photos/broken")
+
+	// every directory is only scanned once
+	names, _, s := scanAll(t, filepath.Join(root, "photos"), ScanOptions{Symlinks: FollowSymlinks})
+	assert.Equal([]string{"a.jpg", "link.jpg", "other/b.jpg"}, names)
+	assert.Equal(int64(1), s.Progress().Failed)
+}
+
+func TestScanCancel(t *testing.T) {
+	assert := assert.New(t)
+
+	files := make(map[string]string)
+	for _, dir := range []string{"a", "b", "c"} {
+		for _, name := range []string{"1", "2", "3", "4", "5"} {
+			files[dir+"/"+name+".jpg"] = jpegData
+		}
+	}
+	root := scanTree(t, files)
+	defer os.RemoveAll(root)
+
+	e := &countingExtractor{block: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, err := Scan(ctx, root, ScanOptions{Extractor: e, Workers: 2})
+	if !assert.NoError(err) {
+		return
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	count := 0
+	for range s.Results() {
+		count++
+	}
+	assert.Equal(0, count)
+	assert.Equal(context.Canceled, s.Err())
+	assert.Equal(2, e.count())
+	assert.Equal(int64(0), s.Progress().Processed)
+}
+
+func TestScanPool(t *testing.T) {
+	assert := assert.New(t)
+
+	pool, err := NewPool("exiftool", 2)
+	if !assert.NoError(err) {
+		return
+	}
+	defer pool.Stop()
+
+	names, errs, s := scanAll(t, "testdata", ScanOptions{Extractor: pool, Include: []string{"IMG_7238*"}})
+	assert.Equal([]string{"IMG_7238-geo.jpg", "IMG_7238-nogeo.jpg", "IMG_7238.JPG"}, names)
+	assert.Empty(errs)
+	assert.Equal(int64(3), s.Progress().Processed)
+}
+
+func TestScanProgressETA(t *testing.T) {
+	assert := assert.New(t)
+
+	p := ScanProgress{Found: 4, Bytes: 400, ProcessedBytes: 100, Processed: 1, Elapsed: time.Second}
+	assert.Equal(3*time.Second, p.ETA())
+
+	// empty files are counted instead
+	p = ScanProgress{Found: 4, Processed: 2, Elapsed: time.Second}
+	assert.Equal(time.Second, p.ETA())
+
+	assert.Equal(time.Duration(0), ScanProgress{Found: 4}.ETA())
+}
@@ -0,0 +1,103 @@
+package exiftool
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// sniffLen is how much of a file SniffMIMEType reads, which is as much as
+// http.DetectContentType considers
+const sniffLen = 512
+
+// signature identifies a file type by bytes at a fixed offset
+type signature struct {
+	offset int
+	magic  string
+	mime   string
+}
+
+// signatures are the raw and other camera formats http.DetectContentType
+// doesn't know, checked in order. Raw formats based on TIFF without their
+// own header, such as DNG, NEF and ARW, are reported as image/tiff.
+var signatures = []signature{
+	{0, "II*\x00\x10\x00\x00\x00CR\x02", "image/x-canon-cr2"},
+	{0, "II\x1a\x00\x00\x00HEAPCCDR", "image/x-canon-crw"},
+	{0, "FUJIFILMCCD-RAW", "image/x-fujifilm-raf"},
+	{0, "IIRO", "image/x-olympus-orf"},
+	{0, "IIRS", "image/x-olympus-orf"},
+	{0, "MMOR", "image/x-olympus-orf"},
+	{0, "IIU\x00", "image/x-panasonic-rw2"},
+	{0, "\x00MRM", "image/x-minolta-mrw"},
+	{0, "FOVb", "image/x-sigma-x3f"},
+	{0, "II*\x00", "image/tiff"},
+	{0, "MM\x00*", "image/tiff"},
+}
+
+// ftypBrands maps the major brand of ISO base media files to their type.
+// Other brands are video/mp4.
+var ftypBrands = map[string]string{
+	"heic": "image/heic", "heix": "image/heic", "hevc": "image/heic",
+	"heim": "image/heic", "heis": "image/heic", "mif1": "image/heif",
+	"msf1": "image/heif", "avif": "image/avif", "avis": "image/avif",
+	"crx ": "image/x-canon-cr3", "qt  ": "video/quicktime",
+	"3gp4": "video/3gpp", "3gp5": "video/3gpp", "3g2a": "video/3gpp2",
+}
+
+// SniffMIMEType guesses the MIME type of filename from its first few bytes
+// without calling exiftool. It knows the common image, raw and video
+// formats and falls back to http.DetectContentType, so unknown files are
+// application/octet-stream.
+func SniffMIMEType(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", errors.Wrap(err, "Could not open file")
+	}
+	defer f.Close()
+
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", errors.Wrap(err, "Could not read file")
+	}
+	return sniff(buf[:n]), nil
+}
+
+func sniff(data []byte) string {
+	for _, s := range signatures {
+		if len(data) >= s.offset+len(s.magic) && string(data[s.offset:s.offset+len(s.magic)]) == s.magic {
+			return s.mime
+		}
+	}
+
+	if len(data) >= 12 && bytes.Equal(data[4:8], []byte("ftyp")) {
+		if mime, ok := ftypBrands[string(data[8:12])]; ok {
+			return mime
+		}
+		return "video/mp4"
+	}
+
+	mime := http.DetectContentType(data)
+	if i := strings.IndexByte(mime, ';'); i >= 0 {
+		mime = mime[:i]
+	}
+	return mime
+}
+
+// matchMIMEType returns true if mime is one of types, which may end in /*
+// to match every subtype
+func matchMIMEType(mime string, types []string) bool {
+	for _, t := range types {
+		if strings.EqualFold(t, mime) {
+			return true
+		}
+		if strings.HasSuffix(t, "/*") && len(mime) > len(t)-1 && strings.EqualFold(t[:len(t)-1], mime[:len(t)-1]) {
+			return true
+		}
+	}
+	return false
+}
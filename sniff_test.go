@@ -0,0 +1,51 @@
+package exiftool
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSniffMIMEType(t *testing.T) {
+	assert := assert.New(t)
+
+	mime, err := SniffMIMEType("testdata/IMG_7238.JPG")
+	if assert.NoError(err) {
+		assert.Equal("image/jpeg", mime)
+	}
+
+	_, err = SniffMIMEType("testdata/missing.jpg")
+	assert.Error(err)
+
+	tests := map[string]string{
+		"II*\x00\x10\x00\x00\x00CR\x02\x00":           "image/x-canon-cr2",
+		"II*\x00\x08\x00\x00\x00":                     "image/tiff",
+		"MM\x00*\x00\x00\x00\x08":                     "image/tiff",
+		"FUJIFILMCCD-RAW 0201":                        "image/x-fujifilm-raf",
+		"IIRO\x08\x00\x00\x00":                        "image/x-olympus-orf",
+		"\x00\x00\x00\x18ftypheic\x00\x00\x00\x00":    "image/heic",
+		"\x00\x00\x00\x18ftypcrx \x00\x00\x00\x01":    "image/x-canon-cr3",
+		"\x00\x00\x00\x14ftypqt  \x00\x00\x02\x00":    "video/quicktime",
+		"\x00\x00\x00\x20ftypisom\x00\x00\x02\x00":    "video/mp4",
+		"\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR":         "image/png",
+		"RIFF\x00\x00\x00\x00WEBPVP8 ":                "image/webp",
+		"just some text":                              "text/plain",
+		"\x00\x01\x02\x03":                            "application/octet-stream",
+		"":                                            "text/plain",
+		"\xff\xd8\xff\xe1\x00\x10Exif\x00\x00II*\x00": "image/jpeg",
+	}
+	for data, want := range tests {
+		assert.Equal(want, sniff([]byte(data)), "%q", data)
+	}
+}
+
+func TestMatchMIMEType(t *testing.T) {
+	assert := assert.New(t)
+
+	types := []string{"image/*", "video/MP4"}
+	assert.True(matchMIMEType("image/jpeg", types))
+	assert.True(matchMIMEType("video/mp4", types))
+	assert.False(matchMIMEType("video/quicktime", types))
+	assert.False(matchMIMEType("image", types))
+	assert.False(matchMIMEType("text/plain", types))
+}
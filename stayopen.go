@@ -3,26 +3,109 @@ package exiftool
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/rand"
 	"fmt"
 	"io"
-	"os/exec"
+	"io/ioutil"
+	"math/big"
+	"os"
 	"strconv"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
+// DefaultMaxRetries is the number of times NewStayOpen configures a Stayopen
+// to retry a request after the exiftool process exits unexpectedly
+const DefaultMaxRetries = 2
+
 // Stayopen abstracts running exiftool with `-stay_open` to greatly improve
 // performance. Remember to call Stayopen.Stop() to signal exiftool to shutdown
 // to avoid zombie perl processes
 type Stayopen struct {
+	// MaxRetries is how many times a request is sent to a new exiftool
+	// process when the current one exits while handling it
+	MaxRetries int
+
+	// OnRestart is called, if set, each time an exited exiftool process
+	// is replaced. It receives the reason the process exited. It runs while
+	// the request that found the process gone is in progress, so it may
+	// call Restarts but must not make requests.
+	OnRestart func(err error)
+
+	// MaxResponseSize limits how many bytes of output are kept for a single
+	// request. Larger responses are discarded and ErrResponseTooLarge is
+	// returned. Zero means no limit.
+	MaxResponseSize int
+
+	// TempDir is where ExtractReader spools streams so exiftool can read
+	// them. The default directory for temporary files is used when empty.
+	TempDir string
+
+	// MaxRequests, MaxAge and MaxRSS replace the exiftool process with a
+	// new one before the next request once it has handled MaxRequests
+	// requests, has been running for MaxAge or its resident memory exceeds
+	// MaxRSS bytes. MaxRSS is read from /proc/<pid>/status so it only works
+	// where that is available. Zero disables each limit.
+	MaxRequests int
+	MaxAge      time.Duration
+	MaxRSS      int64
+
+	// AllowFlags are flags CheckFlags would reject that extraction
+	// requests may use anyway
+	AllowFlags []string
+
 	l   sync.Mutex
-	cmd *exec.Cmd
+	cmd Process
+
+	// closed and proc are guarded by cl rather than l so Close can mark the
+	// Stayopen closed and signal the process while a request holds l.
+	// restarts is too so it can be read without waiting for a request.
+	cl       sync.Mutex
+	closed   bool
+	proc     Process
+	restarts int
+
+	starter  Starter
+	exiftool string
+	flags    []string
+	recycles int
+
+	// started and requests describe the current process for recycling
+	started  time.Time
+	requests int
+
+	stdin io.WriteCloser
+
+	// results and messages receive the output read from stdout and stderr.
+	// They are closed when the pipes reach EOF, which happens when the
+	// process exits
+	results  chan chunk
+	messages chan chunk
 
-	stdin  io.WriteCloser
-	stdout io.ReadCloser
+	// seq numbers each request so its response can be told apart from a
+	// stale one
+	seq int
 
-	scanner *bufio.Scanner
+	// nonce starts the number in the current process's {ready} tokens so
+	// output from exiftool can't pass for one
+	nonce string
+}
+
+// exitedError is returned by execute when the exiftool process is gone
+type exitedError struct {
+	err error
+}
+
+func (e *exitedError) Error() string {
+	if e.err == nil {
+		return "exiftool exited unexpectedly"
+	}
+	return "exiftool exited unexpectedly: " + e.err.Error()
 }
 
 // Extract calls exiftool on the supplied filename
@@ -31,98 +114,637 @@ func (e *Stayopen) Extract(filename string) ([]byte, error) {
 }
 
 func (e *Stayopen) ExtractFlags(filename string, flags ...string) ([]byte, error) {
+	return e.ExtractFlagsContext(context.Background(), filename, flags...)
+}
+
+// ExtractFlagsContext is like ExtractFlags but gives up waiting for exiftool
+// when ctx is done. The exiftool process is replaced with a new one so the
+// abandoned response can not be mistaken for the response to a later request.
+func (e *Stayopen) ExtractFlagsContext(ctx context.Context, filename string, flags ...string) ([]byte, error) {
+	results, _, err := e.ExtractWarnings(ctx, filename, flags...)
+	return results, err
+}
+
+// ExtractWarnings is like ExtractFlagsContext but also returns the warnings
+// exiftool printed while processing the file. If exiftool reported an error
+// it is returned as an *Error along with any output.
+func (e *Stayopen) ExtractWarnings(ctx context.Context, filename string, flags ...string) ([]byte, []Warning, error) {
+	args, err := readArgs(flags, e.AllowFlags, filename)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results, messages, err := e.do(ctx, args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	warnings, err := parseStderr(messages)
+	return results, warnings, err
+}
+
+// ExtractReader is like Extract but reads the file from source. source is
+// copied to a temporary file in TempDir, which is removed afterwards, so the
+// running exiftool process can read it. Pass -fast or -fast2 to stop
+// exiftool reading once it has parsed the headers.
+func (e *Stayopen) ExtractReader(source io.Reader, flags ...string) ([]byte, error) {
+	return e.ExtractReaderContext(context.Background(), source, flags...)
+}
+
+// ExtractReaderContext is like ExtractReader but gives up waiting for
+// exiftool when ctx is done
+func (e *Stayopen) ExtractReaderContext(ctx context.Context, source io.Reader, flags ...string) ([]byte, error) {
+	results, _, err := e.ExtractReaderWarnings(ctx, source, flags...)
+	return results, err
+}
+
+// ExtractReaderWarnings is like ExtractWarnings but reads the file from
+// source. SourceFile in the output is the name of the temporary file.
+func (e *Stayopen) ExtractReaderWarnings(ctx context.Context, source io.Reader, flags ...string) ([]byte, []Warning, error) {
+	filename, err := spool(ctx, e.TempDir, source)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.Remove(filename)
+
+	return e.ExtractWarnings(ctx, filename, flags...)
+}
+
+// do sends args to exiftool, retrying on a new process if the current one
+// exits, and returns what exiftool wrote to stdout and stderr
+func (e *Stayopen) do(ctx context.Context, args []string) ([]byte, []byte, error) {
+	lines, err := encodeArgs(args)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	e.l.Lock()
 	defer e.l.Unlock()
 
-	if e.cmd == nil {
-		return nil, errors.New("Stopped")
+	if e.cmd == nil || e.isClosed() {
+		return nil, nil, ErrStopped
 	}
 
-	if !strconv.CanBackquote(filename) {
-		return nil, ErrFilenameInvalid
+	if e.needsRecycle() {
+		if err := e.recycle(); err != nil {
+			return nil, nil, err
+		}
 	}
 
-	// send the request
-	for _, f := range flags {
-		fmt.Fprintln(e.stdin, f)
+	for attempt := 0; ; attempt++ {
+		e.requests++
+		results, messages, err := e.execute(ctx, lines)
+		exited, ok := err.(*exitedError)
+		if !ok {
+			return results, messages, err
+		}
+
+		// the process was terminated by Close
+		if e.isClosed() {
+			e.cmd = nil
+			return nil, nil, exited
+		}
+
+		e.cl.Lock()
+		e.restarts++
+		e.cl.Unlock()
+		if e.OnRestart != nil {
+			e.OnRestart(exited)
+		}
+
+		if err := e.start(); err != nil {
+			e.cmd = nil
+			return nil, nil, errors.Wrap(err, "Failed restarting exiftool")
+		}
+
+		if attempt >= e.MaxRetries {
+			return nil, nil, exited
+		}
+	}
+}
+
+// Restarts returns how many times an exited exiftool process was replaced
+func (e *Stayopen) Restarts() int {
+	e.cl.Lock()
+	defer e.cl.Unlock()
+	return e.restarts
+}
+
+// Recycles returns how many times the exiftool process was replaced for
+// reaching MaxRequests, MaxAge or MaxRSS
+func (e *Stayopen) Recycles() int {
+	e.l.Lock()
+	defer e.l.Unlock()
+	return e.recycles
+}
+
+// needsRecycle returns true if the process has reached one of its limits
+func (e *Stayopen) needsRecycle() bool {
+	switch {
+	case e.MaxRequests > 0 && e.requests >= e.MaxRequests:
+		return true
+	case e.MaxAge > 0 && time.Since(e.started) >= e.MaxAge:
+		return true
+	case e.MaxRSS > 0 && pid(e.cmd) != 0:
+		rss, err := processRSS(pid(e.cmd))
+		return err == nil && rss > e.MaxRSS
+	}
+	return false
+}
+
+// recycle replaces the process with a new one. The old process has no
+// requests in flight because the lock is held.
+func (e *Stayopen) recycle() error {
+	e.retire()
+	e.recycles++
+
+	if err := e.start(); err != nil {
+		e.cmd = nil
+		return errors.Wrap(err, "Failed replacing exiftool")
 	}
-	fmt.Fprintln(e.stdin, filename)
+	return nil
+}
+
+// retire asks the exiftool process to exit and reaps it in the background
+// so a new one can be started straight away
+func (e *Stayopen) retire() {
+	cmd, results, messages := e.cmd, e.results, e.messages
+
+	fmt.Fprintln(e.stdin, "-stay_open")
+	fmt.Fprintln(e.stdin, "False")
 	fmt.Fprintln(e.stdin, "-execute")
+	e.stdin.Close()
+
+	go func() {
+		drain(results, messages)
+		cmd.Wait()
+	}()
+}
 
-	if !e.scanner.Scan() {
-		return nil, errors.New("Failed to read output")
-	} else {
-		results := e.scanner.Bytes()
-		sendResults := make([]byte, len(results), len(results))
-		copy(sendResults, results)
-		return sendResults, nil
+// processRSS reads the resident memory of a process in bytes from
+// /proc/<pid>/status
+func processRSS(pid int) (int64, error) {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, err
 	}
+	return parseVmRSS(data)
+}
+
+// parseVmRSS finds the `VmRSS:   1234 kB` line in /proc/<pid>/status
+func parseVmRSS(status []byte) (int64, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(status))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "VmRSS:" {
+			continue
+		}
 
+		n, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0, errors.Errorf("Invalid VmRSS %q", fields[1])
+		}
+		if len(fields) > 2 && strings.EqualFold(fields[2], "kB") {
+			n *= 1024
+		}
+		return n, nil
+	}
+	return 0, errors.New("No VmRSS in process status")
 }
 
+// execute sends the argfile lines of a request to exiftool and waits for
+// the response on stdout and the messages written to stderr while handling
+// it
+func (e *Stayopen) execute(ctx context.Context, lines []string) ([]byte, []byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var req bytes.Buffer
+	for _, l := range lines {
+		fmt.Fprintln(&req, l)
+	}
+
+	// -echo3 and -echo4 print once processing is complete. The line break
+	// on stdout puts exiftool's {ready} token on a line of its own, even
+	// after binary output, and the token on stderr keeps it in step with
+	// stdout.
+	e.seq++
+	id := fmt.Sprintf("%s%d", e.nonce, e.seq)
+	echo, err := encodeArgs([]string{"-echo3", "", "-echo4", "\n{ready" + id + "}"})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, l := range echo {
+		fmt.Fprintln(&req, l)
+	}
+	fmt.Fprintf(&req, "-execute%s\n", id)
+
+	if _, err := e.stdin.Write(req.Bytes()); err != nil {
+		return nil, nil, &exitedError{e.kill()}
+	}
+
+	return e.receive(ctx)
+}
+
+// response is the output of one stream collected by receive
+type response struct {
+	chunks   chan chunk
+	data     []byte
+	tooLarge bool
+	done     bool
+}
+
+// pending returns the channel the rest of the response comes from, or nil
+// once it is complete so receive stops reading it
+func (r *response) pending() chan chunk {
+	if r.done {
+		return nil
+	}
+	return r.chunks
+}
+
+// receive collects the response to the current request from stdout and
+// stderr. They are read at the same time, like drain does, because
+// exiftool blocks once the pipe it is writing to is full. Responses to
+// earlier requests are discarded.
+func (e *Stayopen) receive(ctx context.Context) ([]byte, []byte, error) {
+	results := &response{chunks: e.results}
+	messages := &response{chunks: e.messages}
+
+	for !results.done || !messages.done {
+		var r *response
+		var c chunk
+		var ok bool
+		select {
+		case c, ok = <-results.pending():
+			r = results
+		case c, ok = <-messages.pending():
+			r = messages
+		case <-ctx.Done():
+			e.restart()
+			return nil, nil, ctx.Err()
+		}
+
+		if !ok {
+			return nil, nil, &exitedError{e.kill()}
+		}
+		if err := e.add(r, c); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// both streams are read to the end of the response, even when one was
+	// too large, so the next response starts in the right place
+	if results.tooLarge || messages.tooLarge {
+		return nil, nil, ErrResponseTooLarge
+	}
+	for _, r := range []*response{results, messages} {
+		if r.data == nil {
+			r.data = []byte{}
+		}
+	}
+	return results.data, messages.data, nil
+}
+
+// add appends a chunk to r, completing it at the current request's token
+func (e *Stayopen) add(r *response, c chunk) error {
+	if !r.tooLarge {
+		r.data = append(r.data, c.data...)
+		if e.MaxResponseSize > 0 && len(r.data) > e.MaxResponseSize {
+			r.data = nil
+			r.tooLarge = true
+		}
+	}
+
+	if !c.last {
+		return nil
+	}
+
+	if c.seq < e.seq {
+		r.data = nil
+		r.tooLarge = false
+		return nil
+	}
+
+	if c.seq > e.seq {
+		e.restart()
+		return errors.Errorf("Response out of sequence, got %d expected %d", c.seq, e.seq)
+	}
+
+	r.done = true
+	return nil
+}
+
+// stopTimeout is how long Stop waits for exiftool to exit
+const stopTimeout = 5 * time.Second
+
+// terminateDelay is how long Close waits for exiftool to exit after SIGTERM
+// before killing it
+const terminateDelay = time.Second
+
+// Stop is like Close but gives exiftool a few seconds to exit and ignores
+// any errors
 func (e *Stayopen) Stop() {
-	e.l.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+	defer cancel()
+	e.Close(ctx)
+}
+
+// Close waits for the request in flight, if there is one, then asks exiftool
+// to exit and waits for the process to finish. When ctx is done first the
+// process is sent SIGTERM, and then killed if it still hasn't exited. Every
+// request after Close, and Close itself, returns ErrStopped.
+func (e *Stayopen) Close(ctx context.Context) error {
+	e.cl.Lock()
+	if e.closed {
+		e.cl.Unlock()
+		return ErrStopped
+	}
+	e.closed = true
+	e.cl.Unlock()
+
+	var forced error
+
+	locked := make(chan struct{})
+	go func() {
+		e.l.Lock()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+	case <-ctx.Done():
+		// abort the request in flight
+		forced = errors.Wrap(ctx.Err(), "Request in flight was aborted")
+		e.cl.Lock()
+		proc := e.proc
+		e.cl.Unlock()
+		terminate(proc, locked)
+		<-locked
+	}
 	defer e.l.Unlock()
 
-	// write message telling it to close
-	// but don't actually wait for the command to stop
+	if e.cmd == nil {
+		return forced
+	}
+
+	cmd, results, messages := e.cmd, e.results, e.messages
+	e.cmd = nil
+
 	fmt.Fprintln(e.stdin, "-stay_open")
 	fmt.Fprintln(e.stdin, "False")
 	fmt.Fprintln(e.stdin, "-execute")
-	e.cmd = nil
+	e.stdin.Close()
+
+	exited := make(chan struct{})
+	var err error
+	go func() {
+		drain(results, messages)
+		err = cmd.Wait()
+		close(exited)
+	}()
+
+	select {
+	case <-exited:
+	case <-ctx.Done():
+		terminate(cmd, exited)
+		<-exited
+		return errors.Wrap(ctx.Err(), "exiftool did not exit")
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "exiftool exited with an error")
+	}
+	return forced
+}
+
+// terminate sends SIGTERM to proc and kills it if exited isn't closed
+// within terminateDelay. Signals other than kill aren't supported on
+// Windows so the process is killed straight away there.
+func terminate(proc Process, exited chan struct{}) {
+	if proc == nil {
+		return
+	}
+
+	if err := proc.Signal(syscall.SIGTERM); err == nil {
+		select {
+		case <-exited:
+			return
+		case <-time.After(terminateDelay):
+		}
+	}
+	proc.Kill()
+}
+
+// drain discards the output of an exiting process until both readers reach
+// EOF. They are read at the same time in case exiftool is blocked writing
+// to the other one.
+func drain(results, messages chan chunk) {
+	done := make(chan struct{})
+	go func() {
+		for range messages {
+		}
+		close(done)
+	}()
+	for range results {
+	}
+	<-done
+}
+
+func (e *Stayopen) isClosed() bool {
+	e.cl.Lock()
+	defer e.cl.Unlock()
+	return e.closed
 }
 
 func NewStayOpen(exiftool string, flags ...string) (*Stayopen, error) {
+	return NewStayOpenStarter(StartProcess, exiftool, flags...)
+}
 
-	flags = append([]string{"-stay_open", "True", "-@", "-", "-common_args"}, flags...)
+// NewStayOpenBinary is like NewStayOpen but fails straight away if b is too
+// old for stay_open mode
+func NewStayOpenBinary(b *Binary, flags ...string) (*Stayopen, error) {
+	if err := b.Require("-echo4"); err != nil {
+		return nil, err
+	}
+	return NewStayOpen(b.Path, flags...)
+}
 
-	stayopen := &Stayopen{}
-	stayopen.cmd = exec.Command(exiftool, flags...)
+// NewStayOpenStarter is like NewStayOpen but starts exiftool, and any
+// replacement processes, with start
+func NewStayOpenStarter(start Starter, exiftool string, flags ...string) (*Stayopen, error) {
+	stayopen := &Stayopen{
+		MaxRetries: DefaultMaxRetries,
+		starter:    start,
+		exiftool:   exiftool,
+		flags:      flags,
+	}
 
-	stdin, err := stayopen.cmd.StdinPipe()
-	if err != nil {
-		return nil, errors.Wrap(err, "Failed getting stdin pipe")
+	if err := stayopen.start(); err != nil {
+		return nil, err
 	}
 
-	stdout, err := stayopen.cmd.StdoutPipe()
+	return stayopen, nil
+}
+
+// start launches a new exiftool process in stay_open mode
+func (e *Stayopen) start() error {
+	flags := append([]string{"-stay_open", "True", "-@", "-", "-common_args"}, e.flags...)
+	cmd, err := e.starter(e.exiftool, flags...)
 	if err != nil {
-		return nil, errors.Wrap(err, "Failed getting stdout pipe")
+		return errors.Wrap(err, "Failed starting exiftool in stay_open mode")
 	}
 
-	stayopen.stdin = stdin
-	stayopen.stdout = stdout
-	stayopen.scanner = bufio.NewScanner(stdout)
-	stayopen.scanner.Split(splitReadyToken)
+	e.cmd = cmd
+	e.cl.Lock()
+	e.proc = cmd
+	e.cl.Unlock()
+	e.started = time.Now()
+	e.requests = 0
+	e.nonce = newNonce()
+	e.stdin = cmd.Stdin()
+	e.results = readResponses(cmd.Stdout(), e.nonce)
+	e.messages = readResponses(cmd.Stderr(), e.nonce)
+	return nil
+}
 
-	if err := stayopen.cmd.Start(); err != nil {
-		return nil, errors.Wrap(err, "Failed starting exiftool in stay_open mode")
+// newNonce returns a random number for a process's {ready} tokens. They
+// have to be digits as exiftool only accepts a number after -execute.
+func newNonce() string {
+	n, err := rand.Int(rand.Reader, big.NewInt(9e8))
+	if err != nil {
+		// fall back to something that is at least hard to guess from the
+		// output of a single file
+		n = big.NewInt(time.Now().UnixNano() % 9e8)
 	}
+	return strconv.FormatInt(n.Int64()+1e8, 10)
+}
 
-	// wait for both go-routines to startup
-	return stayopen, nil
+// chunk is part of the output exiftool wrote for a request. The final chunk
+// of a response has last set and the seq from its {ready<nonce><seq>} token.
+type chunk struct {
+	data []byte
+	last bool
+	seq  int
 }
 
-func splitReadyToken(data []byte, atEOF bool) (int, []byte, error) {
-	delimPos := bytes.Index(data, []byte("{ready}\n"))
-	delimSize := 8
+// maxReadyTokenSize is more than enough bytes to hold a {ready<nonce><seq>}
+// token and the line breaks around it
+const maxReadyTokenSize = 64
+
+// readResponses streams the output read from r to the returned channel in
+// chunks, closing it once r reaches EOF. Responses are delimited by the
+// tokens with nonce. Responses of any size can be read without buffering
+// them in full.
+func readResponses(r io.Reader, nonce string) chan chunk {
+	chunks := make(chan chunk)
 
-	// maybe we are on Windows?
-	if delimPos == -1 {
-		delimPos = bytes.Index(data, []byte("{ready}\r\n"))
-		delimSize = 9
+	go func() {
+		defer close(chunks)
+
+		var buf []byte
+		readBuf := make([]byte, 32*1024)
+		for {
+			n, err := r.Read(readBuf)
+			buf = append(buf, readBuf[:n]...)
+
+			for {
+				pos, size, seq := findReadyToken(buf, nonce)
+				if pos == -1 {
+					break
+				}
+				chunks <- chunk{data: copyBytes(buf[:pos]), last: true, seq: seq}
+				buf = buf[pos+size:]
+			}
+
+			// hold back enough to complete a token split across reads
+			if keep := maxReadyTokenSize; len(buf) > keep {
+				chunks <- chunk{data: copyBytes(buf[:len(buf)-keep])}
+				buf = append(buf[:0], buf[len(buf)-keep:]...)
+			}
+
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return chunks
+}
+
+func copyBytes(b []byte) []byte {
+	c := make([]byte, len(b), len(b))
+	copy(c, b)
+	return c
+}
+
+// restart replaces the exiftool process, discarding any responses still
+// pending. The Stayopen is stopped if a new process can't be started.
+func (e *Stayopen) restart() {
+	e.kill()
+	if e.isClosed() {
+		e.cmd = nil
+		return
+	}
+	if err := e.start(); err != nil {
+		e.cmd = nil
 	}
+}
 
-	if delimPos == -1 { // still no token found
-		if atEOF {
-			return 0, data, io.EOF
-		} else {
-			return 0, nil, nil
+// kill forcefully stops the exiftool process, waits for it to exit and
+// returns why it exited
+func (e *Stayopen) kill() error {
+	e.cmd.Kill()
+
+	// discard anything still buffered so the readers can see EOF
+	for range e.results {
+	}
+	for range e.messages {
+	}
+
+	return e.cmd.Wait()
+}
+
+// findReadyToken returns the position, size and sequence number of the first
+// {ready<nonce><seq>} token in data. A token is only matched on a line of
+// its own, and the line break before it, which -echo3 or -echo4 printed, is
+// part of the token. Output can't end a response early without knowing the
+// nonce. pos is -1 when there is no token.
+func findReadyToken(data []byte, nonce string) (pos, size, seq int) {
+	prefix := []byte("\n{ready" + nonce)
+	offset := 0
+	for {
+		i := bytes.Index(data[offset:], prefix)
+		if i == -1 {
+			return -1, 0, 0
 		}
-	} else {
-		if atEOF && len(data) == (delimPos+delimSize) { // nothing left to scan
-			return delimPos + delimSize, data[:delimPos], bufio.ErrFinalToken
-		} else {
-			return delimPos + delimSize, data[:delimPos], nil
+
+		pos = offset + i
+		digits := pos + len(prefix)
+		end := digits
+		for end < len(data) && data[end] >= '0' && data[end] <= '9' {
+			end++
 		}
+
+		if end > digits {
+			switch rest := data[end:]; {
+			case bytes.HasPrefix(rest, []byte("}\n")):
+				size = end + 2 - pos
+			case bytes.HasPrefix(rest, []byte("}\r\n")): // maybe we are on Windows?
+				size = end + 3 - pos
+				if pos > 0 && data[pos-1] == '\r' {
+					pos--
+					size++
+				}
+			}
+
+			if size > 0 {
+				seq, _ = strconv.Atoi(string(data[digits:end]))
+				return pos, size, seq
+			}
+		}
+
+		offset = pos + 1
 	}
 }
@@ -1,12 +1,18 @@
 package exiftool
 
 import (
-	"bufio"
-	"io"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing/iotest"
+	"time"
 
 	"testing"
 
 	"github.com/buger/jsonparser"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -47,101 +53,217 @@ func TestStayOpen(t *testing.T) {
 	assert.Error(err)
 }
 
+func TestStayOpenFileNotFound(t *testing.T) {
+	assert := assert.New(t)
+
+	stayopen, err := NewStayOpen("exiftool", "-json")
+	if !assert.NoError(err) {
+		return
+	}
+	defer stayopen.Stop()
+
+	_, warnings, err := stayopen.ExtractWarnings(context.Background(), "testdata/does-not-exist.jpg")
+	assert.Equal(ErrFileNotFound, errors.Cause(err))
+	assert.Len(warnings, 0)
+
+	// stderr must stay in step with stdout for the next request
+	data, err := stayopen.ExtractFlags("testdata/IMG_7238.JPG", "-ShutterSpeed")
+	if !assert.NoError(err) {
+		return
+	}
+	if ss, err := jsonparser.GetString(data, "[0]", "ShutterSpeed"); assert.NoError(err) {
+		assert.Equal("1/123", ss)
+	}
+}
+
+func TestStayOpenDiscardsStaleResponses(t *testing.T) {
+	assert := assert.New(t)
+
+	stayopen, err := NewStayOpen("exiftool", "-json")
+	if !assert.NoError(err) {
+		return
+	}
+	defer stayopen.Stop()
+
+	// a request whose response nobody is waiting for
+	_, err = fmt.Fprintf(stayopen.stdin, "testdata/IMG_7238.JPG\n-echo3\n#[CSTR]\n-echo4\n#[CSTR]\\n{ready%[1]s0}\n-execute%[1]s0\n", stayopen.nonce)
+	if !assert.NoError(err) {
+		return
+	}
+
+	data, err := stayopen.ExtractFlags("testdata/IMG_7238.JPG", "-ShutterSpeed")
+	if !assert.NoError(err) {
+		return
+	}
+
+	// make sure we got the response for -ShutterSpeed and not the stale one
+	createDate, err := jsonparser.GetString(data, "[0]", "CreateDate")
+	assert.Error(err)
+	assert.Equal("", createDate)
+	if ss, err := jsonparser.GetString(data, "[0]", "ShutterSpeed"); assert.NoError(err) {
+		assert.Equal("1/123", ss)
+	}
+}
+
 func TestStayOpenErrorsOnBadBin(t *testing.T) {
 	_, err := NewStayOpen("not.a.rea.bin")
 	assert.Error(t, err)
 }
 
-func TestSplitReadyToken(t *testing.T) {
+func TestFindReadyTokenSequenced(t *testing.T) {
 	assert := assert.New(t)
-	data := []byte("xxx{ready}\nyyy\n{ready}\nzzz{ready}\n")
 
-	advance, token, err := splitReadyToken(data, false)
-	assert.NoError(err)
-	assert.Equal(11, advance)
-	assert.Equal([]byte("xxx"), token)
+	// metadata that contains a {ready} token, even a sequenced one at the
+	// start of a line, must not end the response
+	data := []byte("xxx{ready}\n{ready12}\nyyy{ready12}\n\n{ready55512}\nzzz\r\n{ready55513}\r\n")
 
-	// note that yyy has extra line ending characters
-	data = data[advance:]
-	advance, token, err = splitReadyToken(data, false)
-	assert.NoError(err)
-	assert.Equal(12, advance)
-	assert.Equal([]byte("yyy\n"), token)
-
-	data = data[advance:]
-	advance, token, err = splitReadyToken(data, true)
-	assert.Equal(bufio.ErrFinalToken, err)
-	assert.Equal(11, advance)
-	assert.Equal([]byte("zzz"), token)
+	pos, size, seq := findReadyToken(data, "555")
+	assert.Equal(34, pos)
+	assert.Equal(14, size)
+	assert.Equal(12, seq)
+
+	data = data[pos+size:]
+	pos, size, seq = findReadyToken(data, "555")
+	assert.Equal(3, pos)
+	assert.Equal(16, size)
+	assert.Equal(13, seq)
+
+	for _, partial := range []string{"xxx\n{ready5551", "xxx\n{ready55512}", "xxx\n{ready55512}\r", "xxx{ready55512}\n"} {
+		pos, _, _ := findReadyToken([]byte(partial), "555")
+		assert.Equal(-1, pos, partial)
+	}
 }
 
-func TestSplitReadyTokenWindows(t *testing.T) {
+func TestReadResponses(t *testing.T) {
 	assert := assert.New(t)
 
-	data := []byte("xxx{ready}\r\nyyy\r\n{ready}\r\nzzz{ready}\r\n")
-	advance, token, err := splitReadyToken(data, false)
-	assert.NoError(err)
-	assert.Equal(12, advance)
-	assert.Equal([]byte("xxx"), token)
+	// much larger than bufio.MaxScanTokenSize and split into single bytes
+	// so tokens are always split across reads
+	big := bytes.Repeat([]byte("x"), 100*1024)
+	input := append(append([]byte{}, big...), "\n{ready7771}\nsmall\r\n{ready7772}\r\n"...)
 
-	// note that yyy has extra line ending characters
-	data = data[advance:]
-	advance, token, err = splitReadyToken(data, false)
-	assert.NoError(err)
-	assert.Equal(14, advance)
-	assert.Equal([]byte("yyy\r\n"), token)
-
-	data = data[advance:]
-	advance, token, err = splitReadyToken(data, true)
-	assert.Equal(bufio.ErrFinalToken, err)
-	assert.Equal(12, advance)
-	assert.Equal([]byte("zzz"), token)
+	var responses [][]byte
+	var seqs []int
+	var data []byte
+	for c := range readResponses(iotest.OneByteReader(bytes.NewReader(input)), "777") {
+		data = append(data, c.data...)
+		if c.last {
+			responses = append(responses, data)
+			seqs = append(seqs, c.seq)
+			data = nil
+		}
+	}
+
+	if assert.Len(responses, 2) {
+		assert.Equal(big, responses[0])
+		assert.Equal([]byte("small"), responses[1])
+	}
+	assert.Equal([]int{1, 2}, seqs)
 }
 
-// TestSplitReadyTokenPartial tests that more data is requested
-// when we don't have a full delimter yet
-func TestSplitReadyTokenPartial(t *testing.T) {
+func TestStayOpenExtractReader(t *testing.T) {
 	assert := assert.New(t)
-	data := []byte("xxx\n{ready}")                      // missing \n
-	advance, token, err := splitReadyToken(data, false) // not at EOF
-	assert.Equal(0, advance)
-	assert.Nil(token)
-	assert.Nil(err)
+
+	stayopen, err := NewStayOpen("exiftool", "-json")
+	if !assert.NoError(err) {
+		return
+	}
+	defer stayopen.Stop()
+
+	dir, err := ioutil.TempDir("", "go-exiftool")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	stayopen.TempDir = dir
+
+	for _, flags := range [][]string{nil, {"-fast"}, {"-fast2"}} {
+		f, err := os.Open("testdata/IMG_7238.JPG")
+		if !assert.NoError(err) {
+			return
+		}
+
+		data, err := stayopen.ExtractReader(f, flags...)
+		f.Close()
+		if !assert.NoError(err, "flags %v", flags) {
+			continue
+		}
+		if createDate, err := jsonparser.GetString(data, "[0]", "CreateDate"); assert.NoError(err) {
+			assert.Equal("2016:06:17 19:16:43", createDate)
+		}
+	}
+
+	// the spooled files are removed
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(err)
+	assert.Empty(files)
 }
 
-// TestSplitReadyToken tests behaviour when we've hit
-// EOF on a Reader but we don't have a full delimiter yet
-func TestSplitReadyTokenEOF(t *testing.T) {
+func TestStayOpenRecycle(t *testing.T) {
 	assert := assert.New(t)
-	data := []byte("xxx\n{ready") // no full token
-	advance, token, err := splitReadyToken(data, true)
-
-	// we should get an io.EOF error and get back all
-	// the data that couldn't be parsed
-	assert.Equal(0, advance)
-	assert.Equal(io.EOF, err)
-	assert.Equal(data, token)
+
+	stayopen, err := NewStayOpen("exiftool", "-json")
+	if !assert.NoError(err) {
+		return
+	}
+	defer stayopen.Stop()
+
+	stayopen.MaxRequests = 2
+	pids := make(map[int]bool)
+	for i := 0; i < 5; i++ {
+		data, err := stayopen.Extract("testdata/IMG_7238.JPG")
+		if assert.NoError(err) {
+			ss, _ := jsonparser.GetString(data, "[0]", "ShutterSpeed")
+			assert.Equal("1/123", ss)
+		}
+		pids[pid(stayopen.cmd)] = true
+	}
+	assert.Equal(2, stayopen.Recycles())
+	assert.Len(pids, 3)
+	assert.Equal(0, stayopen.Restarts())
+
+	stayopen.MaxRequests = 0
+	stayopen.MaxAge = time.Nanosecond
+	_, err = stayopen.Extract("testdata/IMG_7238.JPG")
+	assert.NoError(err)
+	assert.Equal(3, stayopen.Recycles())
+
+	stayopen.MaxAge = 0
+	stayopen.MaxRSS = 1
+	if _, err := processRSS(pid(stayopen.cmd)); err == nil {
+		_, err = stayopen.Extract("testdata/IMG_7238.JPG")
+		assert.NoError(err)
+		assert.Equal(4, stayopen.Recycles())
+	}
 }
 
-func TestSplitReadyTokenFinalToken(t *testing.T) {
+func TestParseVmRSS(t *testing.T) {
 	assert := assert.New(t)
-	data := []byte("--\n{ready}\n") // just a ready token
-	advance, token, err := splitReadyToken(data, true)
-	assert.Equal(11, advance)
-	assert.Equal([]byte("--\n"), token)
-	assert.Equal(bufio.ErrFinalToken, err)
+
+	rss, err := parseVmRSS([]byte("Name:\tperl\nVmPeak:\t   30000 kB\nVmRSS:\t   12345 kB\nThreads:\t1\n"))
+	assert.NoError(err)
+	assert.Equal(int64(12345*1024), rss)
+
+	_, err = parseVmRSS([]byte("Name:\tperl\n"))
+	assert.Error(err)
 }
 
-func TestSplitReadyTokenNoData(t *testing.T) {
+func TestStayOpenClose(t *testing.T) {
 	assert := assert.New(t)
-	data := []byte("{ready}\n{ready}\n")
-	advance, token, err := splitReadyToken(data, false)
-	assert.Equal(8, advance)
-	assert.Len(token, 0)
-	assert.NoError(err)
 
-	advance, token, err = splitReadyToken(data, true)
-	assert.Equal(8, advance)
-	assert.Len(token, 0)
+	stayopen, err := NewStayOpen("exiftool", "-json")
+	if !assert.NoError(err) {
+		return
+	}
+	cmd := stayopen.cmd.(*execProcess).cmd
+
+	_, err = stayopen.Extract("testdata/IMG_7238.JPG")
 	assert.NoError(err)
+
+	assert.NoError(stayopen.Close(context.Background()))
+	assert.NotNil(cmd.ProcessState, "process should be reaped")
+
+	_, err = stayopen.Extract("testdata/IMG_7238.JPG")
+	assert.Equal(ErrStopped, err)
+	assert.Equal(ErrStopped, stayopen.Close(context.Background()))
 }
@@ -0,0 +1,100 @@
+//go:build !windows
+// +build !windows
+
+package exiftool
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/buger/jsonparser"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestStayOpenContextTimeout uses a named pipe that nothing writes to so
+// exiftool blocks reading it until the deadline passes
+func TestStayOpenContextTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "go-exiftool")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	fifo := filepath.Join(dir, "hang.jpg")
+	if !assert.NoError(syscall.Mkfifo(fifo, 0600)) {
+		return
+	}
+
+	stayopen, err := NewStayOpen("exiftool", "-json")
+	if !assert.NoError(err) {
+		return
+	}
+	defer stayopen.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	_, err = stayopen.ExtractFlagsContext(ctx, fifo)
+	assert.Equal(context.DeadlineExceeded, err)
+
+	// the next response must belong to the next request
+	data, err := stayopen.ExtractFlags("testdata/IMG_7238.JPG", "-ShutterSpeed")
+	if !assert.NoError(err) {
+		return
+	}
+	if ss, err := jsonparser.GetString(data, "[0]", "ShutterSpeed"); assert.NoError(err) {
+		assert.Equal("1/123", ss)
+	}
+}
+
+// TestStayOpenCloseForced closes a Stayopen while a request is blocked on a
+// named pipe so the process has to be terminated
+func TestStayOpenCloseForced(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "go-exiftool")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	fifo := filepath.Join(dir, "hang.jpg")
+	if !assert.NoError(syscall.Mkfifo(fifo, 0600)) {
+		return
+	}
+
+	stayopen, err := NewStayOpen("exiftool", "-json")
+	if !assert.NoError(err) {
+		return
+	}
+	cmd := stayopen.cmd.(*execProcess).cmd
+
+	inFlight := make(chan error)
+	go func() {
+		_, err := stayopen.Extract(fifo)
+		inFlight <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err = stayopen.Close(ctx)
+	assert.Equal(context.DeadlineExceeded, errors.Cause(err))
+	assert.Error(<-inFlight)
+
+	// the process was reaped and isn't replaced
+	assert.NotNil(cmd.ProcessState)
+	assert.Equal(0, stayopen.Restarts())
+
+	_, err = stayopen.Extract("testdata/IMG_7238.JPG")
+	assert.Equal(ErrStopped, err)
+}
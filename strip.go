@@ -0,0 +1,284 @@
+package exiftool
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrStripIncomplete is returned by Strip when tags the policy should have
+// removed are still in the file. The StripReport lists them in Remaining.
+var ErrStripIncomplete = errors.New("Tags remain after stripping")
+
+// StripPolicy describes which tags Strip removes.
+//
+// Tag names may be group qualified, like `GPS:all` or `XMP:City`, and may
+// contain the wildcards `*` and `?`. `all` matches every tag.
+type StripPolicy struct {
+	Name string
+
+	// Delete lists the tags and groups to remove
+	Delete []string
+
+	// Keep lists tags that are copied back from the original file after
+	// deleting, for policies that delete `all`
+	Keep []string
+
+	// Verify lists the tags that must be gone after stripping. Delete is
+	// used when it is empty. Tags matching Keep are never reported.
+	Verify []string
+}
+
+var (
+	locationTags = []string{
+		"GPS:all", "gps*",
+		"Location*", "City", "Sub-location", "Province-State", "State", "Country*",
+	}
+
+	deviceTags = []string{"*SerialNumber", "*OwnerName"}
+
+	// StripLocation removes GPS coordinates and named places
+	StripLocation = StripPolicy{
+		Name:   "location",
+		Delete: locationTags,
+	}
+
+	// StripDeviceIDs removes camera and lens serial numbers and the name of
+	// the camera's owner
+	StripDeviceIDs = StripPolicy{
+		Name:   "device identifiers",
+		Delete: deviceTags,
+	}
+
+	// StripAllButOrientation removes all metadata except the orientation and
+	// the ICC color profile, which change how the image is displayed.
+	// exiftool may add mandatory EXIF tags when it writes Orientation back,
+	// so only groups that can carry personal data are verified.
+	StripAllButOrientation = StripPolicy{
+		Name:   "all but orientation and color profile",
+		Delete: []string{"all"},
+		Keep:   []string{"Orientation", "ICC_Profile"},
+		Verify: append(append([]string{
+			"XMP:all", "IPTC:all", "MakerNotes:all", "Photoshop:all",
+			"Artist", "Copyright", "Comment", "UserComment", "ImageDescription",
+		}, locationTags...), deviceTags...),
+	}
+)
+
+// changes turns the policy into the TagChanges that apply it
+func (p StripPolicy) changes() (TagChanges, error) {
+	if len(p.Delete) == 0 {
+		return TagChanges{}, errors.New("Strip policy has no tags to delete")
+	}
+
+	changes := TagChanges{Delete: p.Delete}
+	if len(p.Keep) > 0 {
+		changes.CopyFrom = "@"
+		changes.CopyTags = p.Keep
+	}
+	return changes, nil
+}
+
+// remaining lists the tags in m that the policy should have removed
+func (p StripPolicy) remaining(m *Metadata) []string {
+	verify := p.Verify
+	if len(verify) == 0 {
+		verify = p.Delete
+	}
+
+	var left []string
+	for _, key := range m.Tags() {
+		if ignoreStripTag(key) || !matchAnyTag(verify, key) || matchAnyTag(p.Keep, key) {
+			continue
+		}
+		left = append(left, key)
+	}
+	return left
+}
+
+// StripReport describes what Strip removed
+type StripReport struct {
+	Policy string
+
+	// Removed lists the tags that were in the file before and are gone
+	// afterwards, named like `EXIF:GPS:GPSLatitude`
+	Removed []string
+
+	// Remaining lists tags the policy should have removed that are still
+	// in the file. Strip returns ErrStripIncomplete when it isn't empty.
+	Remaining []string
+
+	Warnings []Warning
+}
+
+// stripReadFlags make exiftool print every tag with both its general and
+// specific group so policies can match either
+var stripReadFlags = []string{"-a", "-G0:1"}
+
+// ignoreStripTag skips tags describing the file itself rather than its
+// metadata, which can't be removed
+func ignoreStripTag(key string) bool {
+	if key == "SourceFile" {
+		return true
+	}
+	switch strings.SplitN(key, ":", 2)[0] {
+	case "File", "System", "ExifTool", "Composite":
+		return true
+	}
+	return false
+}
+
+// matchTag reports whether a tag read with -G0:1, such as
+// `EXIF:GPS:GPSLatitude`, matches pattern
+func matchTag(pattern, key string) bool {
+	groups := strings.Split(key, ":")
+	name := groups[len(groups)-1]
+	groups = groups[:len(groups)-1]
+
+	group := ""
+	if i := strings.LastIndex(pattern, ":"); i != -1 {
+		group, pattern = pattern[:i], pattern[i+1:]
+	}
+	if strings.EqualFold(pattern, "all") {
+		pattern = "*"
+	}
+
+	if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(name)); !ok {
+		return false
+	}
+
+	if group == "" {
+		return true
+	}
+	for _, g := range groups {
+		if strings.EqualFold(g, group) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAnyTag(patterns []string, key string) bool {
+	for _, p := range patterns {
+		if matchTag(p, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// tagWriter is what stripping needs from exiftool. It is implemented by
+// Stayopen, Pool and Command.
+type tagWriter interface {
+	ExtractMetadata(ctx context.Context, filename string, flags ...string) (*Metadata, error)
+	WriteTags(ctx context.Context, changes TagChanges, filenames ...string) (*WriteResult, error)
+}
+
+// strip applies policy to filename in place and checks the result
+func strip(ctx context.Context, w tagWriter, policy StripPolicy, filename string) (*StripReport, error) {
+	changes, err := policy.changes()
+	if err != nil {
+		return nil, err
+	}
+
+	before, err := w.ExtractMetadata(ctx, filename, stripReadFlags...)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := w.WriteTags(ctx, changes, filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := result.Files[0].Err; err != nil {
+		return nil, err
+	}
+
+	after, err := w.ExtractMetadata(ctx, filename, stripReadFlags...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed verifying stripped file")
+	}
+
+	report := &StripReport{
+		Policy:    policy.Name,
+		Remaining: policy.remaining(after),
+		Warnings:  append(result.Warnings, result.Files[0].Warnings...),
+	}
+	for _, key := range before.Tags() {
+		if _, ok := after.vals[key]; !ok && !ignoreStripTag(key) {
+			report.Removed = append(report.Removed, key)
+		}
+	}
+
+	if len(report.Remaining) > 0 {
+		return report, ErrStripIncomplete
+	}
+	return report, nil
+}
+
+// stripReader copies src to a temporary file, strips it and copies the
+// result to dst
+func stripReader(ctx context.Context, w tagWriter, policy StripPolicy, src io.Reader, dst io.Writer) (*StripReport, error) {
+	filename, err := spool(ctx, "", src)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(filename)
+
+	report, err := strip(ctx, w, policy, filename)
+	if err != nil {
+		return report, err
+	}
+
+	stripped, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed reading stripped file")
+	}
+	defer stripped.Close()
+
+	if _, err := io.Copy(dst, stripped); err != nil {
+		return nil, errors.Wrap(err, "Failed copying stripped file")
+	}
+	return report, nil
+}
+
+// Strip removes the tags in policy from filename, overwriting it, and then
+// reads the file again to check they are gone. ErrStripIncomplete is
+// returned with the report if any remain.
+func Strip(ctx context.Context, exiftool string, policy StripPolicy, filename string) (*StripReport, error) {
+	return strip(ctx, Command(exiftool), policy, filename)
+}
+
+// StripReader is like Strip but reads the file from src and writes the
+// stripped file to dst. Nothing is written to dst when stripping fails.
+func StripReader(ctx context.Context, exiftool string, policy StripPolicy, src io.Reader, dst io.Writer) (*StripReport, error) {
+	return stripReader(ctx, Command(exiftool), policy, src, dst)
+}
+
+// Strip removes the tags in policy from filename. See the package level
+// Strip.
+func (e *Stayopen) Strip(ctx context.Context, policy StripPolicy, filename string) (*StripReport, error) {
+	return strip(ctx, e, policy, filename)
+}
+
+// StripReader is like Strip but reads the file from src and writes the
+// stripped file to dst
+func (e *Stayopen) StripReader(ctx context.Context, policy StripPolicy, src io.Reader, dst io.Writer) (*StripReport, error) {
+	return stripReader(ctx, e, policy, src, dst)
+}
+
+// Strip removes the tags in policy from filename. See the package level
+// Strip.
+func (p *Pool) Strip(ctx context.Context, policy StripPolicy, filename string) (*StripReport, error) {
+	return strip(ctx, p, policy, filename)
+}
+
+// StripReader is like Strip but reads the file from src and writes the
+// stripped file to dst
+func (p *Pool) StripReader(ctx context.Context, policy StripPolicy, src io.Reader, dst io.Writer) (*StripReport, error) {
+	return stripReader(ctx, p, policy, src, dst)
+}
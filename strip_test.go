@@ -0,0 +1,108 @@
+package exiftool
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchTag(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(matchTag("GPS:all", "EXIF:GPS:GPSLatitude"))
+	assert.True(matchTag("EXIF:all", "EXIF:GPS:GPSLatitude"))
+	assert.True(matchTag("gps*", "XMP:XMP-exif:GPSLatitude"))
+	assert.True(matchTag("*SerialNumber", "MakerNotes:Canon:InternalSerialNumber"))
+	assert.True(matchTag("City", "IPTC:IPTC:City"))
+	assert.True(matchTag("all", "Make"))
+
+	assert.False(matchTag("GPS:all", "XMP:XMP-exif:GPSLatitude"))
+	assert.False(matchTag("XMP:City", "IPTC:IPTC:City"))
+	assert.False(matchTag("*SerialNumber", "EXIF:ExifIFD:SerialNumberFormat"))
+
+	assert.True(ignoreStripTag("File:System:FileName"))
+	assert.True(ignoreStripTag("Composite:Composite:GPSPosition"))
+	assert.False(ignoreStripTag("EXIF:IFD0:Make"))
+}
+
+func TestStripPolicyRemaining(t *testing.T) {
+	list, err := ParseMetadata([]byte(`[{
+	  "SourceFile": "a.jpg",
+	  "File:System:FileName": "a.jpg",
+	  "EXIF:IFD0:Orientation": "Horizontal (normal)",
+	  "EXIF:IFD0:Artist": "Jane Doe",
+	  "EXIF:GPS:GPSLatitude": "37 deg 46' 29.64\" N",
+	  "Composite:Composite:GPSPosition": "37 deg 46' 29.64\" N, 122 deg 25' 9.84\" W"
+	}]`))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, []string{"EXIF:GPS:GPSLatitude"}, StripLocation.remaining(list[0]))
+	assert.Equal(t, []string{"EXIF:IFD0:Artist", "EXIF:GPS:GPSLatitude"}, StripAllButOrientation.remaining(list[0]))
+	assert.Empty(t, StripDeviceIDs.remaining(list[0]))
+
+	custom := StripPolicy{Name: "custom", Delete: []string{"all"}, Keep: []string{"Orientation"}}
+	assert.Equal(t, []string{"EXIF:IFD0:Artist", "EXIF:GPS:GPSLatitude"}, custom.remaining(list[0]))
+
+	_, err = StripPolicy{Name: "empty"}.changes()
+	assert.Error(t, err)
+}
+
+func TestStrip(t *testing.T) {
+	assert := assert.New(t)
+
+	filename, cleanup := copyTestImage(t, "IMG_7238-geo.jpg")
+	defer cleanup()
+
+	ctx := context.Background()
+	report, err := Strip(ctx, "exiftool", StripLocation, filename)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal("location", report.Policy)
+	assert.Contains(report.Removed, "EXIF:GPS:GPSLatitude")
+	assert.Empty(report.Remaining)
+
+	meta, err := ExtractMetadata(ctx, "exiftool", filename)
+	if assert.NoError(err) {
+		_, err = meta.Location()
+		assert.Equal(ErrNoLocation, err)
+		assert.True(meta.Has("Make"))
+	}
+}
+
+func TestStayOpenStripReader(t *testing.T) {
+	assert := assert.New(t)
+
+	stayopen, err := NewStayOpen("exiftool")
+	if !assert.NoError(err) {
+		return
+	}
+	defer stayopen.Stop()
+
+	src, err := os.Open("testdata/IMG_7238-geo.jpg")
+	if !assert.NoError(err) {
+		return
+	}
+	defer src.Close()
+
+	ctx := context.Background()
+	var dst bytes.Buffer
+	report, err := stayopen.StripReader(ctx, StripAllButOrientation, src, &dst)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Empty(report.Remaining)
+	assert.NotZero(dst.Len())
+
+	meta, err := ExtractReaderMetadata(ctx, "exiftool", &dst)
+	if assert.NoError(err) {
+		_, err = meta.Location()
+		assert.Equal(ErrNoLocation, err)
+		assert.True(meta.Has("Orientation"))
+	}
+}
@@ -0,0 +1,285 @@
+package exiftool
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/buger/jsonparser"
+	"github.com/pkg/errors"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// UnmarshalError describes a tag that could not be stored in a struct field
+type UnmarshalError struct {
+	Tag   string
+	Field string
+	Err   error
+}
+
+func (e *UnmarshalError) Error() string {
+	return fmt.Sprintf("Cannot unmarshal %s into %s: %s", e.Tag, e.Field, e.Err.Error())
+}
+
+// Cause supports github.com/pkg/errors.Cause
+func (e *UnmarshalError) Cause() error {
+	return e.Err
+}
+
+// Unmarshal parses the JSON exiftool prints with -json and stores the tags
+// in v. v must be a pointer to a struct, which receives the first file's
+// tags, or a pointer to a slice of structs, which receives one element per
+// file.
+//
+// Struct fields are matched to tags using the `exif` field tag. The name
+// may be group qualified (`exif:"EXIF:CreateDate"`) and can be followed by
+// `,required` to return an error when the tag is missing. Fields without an
+// `exif` tag use the field name, except for struct fields which are filled
+// from the same tags as their parent. Use `exif:"-"` to skip a field.
+//
+// Tags are converted to strings, booleans, integers, floats, time.Time,
+// []byte, slices and structs (for -struct output). Pointer fields are left
+// nil when their tag is missing.
+func Unmarshal(data []byte, v interface{}) error {
+	list, err := ParseMetadata(data)
+	if err != nil {
+		return err
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("Unmarshal requires a non-nil pointer")
+	}
+
+	if rv.Elem().Kind() == reflect.Slice {
+		slice := rv.Elem()
+		elemType := slice.Type().Elem()
+		out := reflect.MakeSlice(slice.Type(), len(list), len(list))
+		for i, m := range list {
+			target := out.Index(i).Addr()
+			if elemType.Kind() == reflect.Ptr {
+				target = reflect.New(elemType.Elem())
+				out.Index(i).Set(target)
+			}
+			if err := m.Unmarshal(target.Interface()); err != nil {
+				return err
+			}
+		}
+		slice.Set(out)
+		return nil
+	}
+
+	if len(list) == 0 {
+		return errors.New("No metadata")
+	}
+	return list[0].Unmarshal(v)
+}
+
+// Unmarshal stores the tags in v, which must be a pointer to a struct. See
+// the package level Unmarshal for how fields are matched to tags.
+func (m *Metadata) Unmarshal(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("Unmarshal requires a non-nil pointer to a struct")
+	}
+
+	return m.unmarshalStruct(rv.Elem())
+}
+
+func (m *Metadata) unmarshalStruct(sv reflect.Value) error {
+	st := sv.Type()
+	for i := 0; i < st.NumField(); i++ {
+		field := st.Field(i)
+		if field.PkgPath != "" && !field.Anonymous { // unexported
+			continue
+		}
+
+		name, opts := parseFieldTag(field.Tag.Get("exif"))
+		if name == "-" {
+			continue
+		}
+
+		fv := sv.Field(i)
+		if name == "" {
+			if isNestedStruct(field.Type) {
+				if field.PkgPath != "" && fv.Kind() == reflect.Ptr {
+					continue // can't allocate an unexported embedded pointer
+				}
+				if err := m.unmarshalNested(fv); err != nil {
+					return err
+				}
+				continue
+			}
+			if field.PkgPath != "" {
+				continue
+			}
+			name = field.Name
+		}
+
+		v, ok := m.lookup(name)
+		if !ok {
+			if opts["required"] {
+				return &UnmarshalError{Tag: name, Field: fieldName(st, field), Err: ErrTagNotFound}
+			}
+			continue
+		}
+
+		if err := setField(fv, v); err != nil {
+			return &UnmarshalError{Tag: name, Field: fieldName(st, field), Err: err}
+		}
+	}
+
+	return nil
+}
+
+// unmarshalNested fills an untagged struct field from the same tags as
+// its parent
+func (m *Metadata) unmarshalNested(fv reflect.Value) error {
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		fv = fv.Elem()
+	}
+	return m.unmarshalStruct(fv)
+}
+
+// fieldName names a field for error messages
+func fieldName(st reflect.Type, field reflect.StructField) string {
+	if st.Name() == "" {
+		return field.Name
+	}
+	return st.Name() + "." + field.Name
+}
+
+func isNestedStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t != timeType
+}
+
+func parseFieldTag(tag string) (string, map[string]bool) {
+	parts := strings.Split(tag, ",")
+	opts := make(map[string]bool)
+	for _, o := range parts[1:] {
+		opts[strings.TrimSpace(o)] = true
+	}
+	return strings.TrimSpace(parts[0]), opts
+}
+
+// setField converts v to the type of fv and stores it
+func setField(fv reflect.Value, v value) error {
+	if fv.Kind() == reflect.Ptr {
+		elem := reflect.New(fv.Type().Elem())
+		if err := setField(elem.Elem(), v); err != nil {
+			return err
+		}
+		fv.Set(elem)
+		return nil
+	}
+
+	if fv.Type() == timeType {
+		s, ok := v.text()
+		if !ok {
+			return errors.New("not a date")
+		}
+		t, _, err := parseDate(s)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.Struct:
+		if v.typ != jsonparser.Object {
+			return errors.New("not a structure")
+		}
+		nested, err := newMetadata(v.data)
+		if err != nil {
+			return err
+		}
+		return nested.unmarshalStruct(fv)
+	case reflect.Slice:
+		return setSlice(fv, v)
+	}
+
+	s, ok := v.text()
+	if !ok {
+		return errors.Errorf("cannot convert %s to %s", v.typ, fv.Type())
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		b, ok := parseBool(s)
+		if !ok {
+			return errors.Errorf("cannot convert %q to %s", s, fv.Type())
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil || fv.OverflowInt(i) {
+			return errors.Errorf("cannot convert %q to %s", s, fv.Type())
+		}
+		fv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(strings.TrimSpace(s), 10, 64)
+		if err != nil || fv.OverflowUint(u) {
+			return errors.Errorf("cannot convert %q to %s", s, fv.Type())
+		}
+		fv.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, ok := parseFloat(s)
+		if !ok || fv.OverflowFloat(f) {
+			return errors.Errorf("cannot convert %q to %s", s, fv.Type())
+		}
+		fv.SetFloat(f)
+	default:
+		return errors.Errorf("unsupported field type %s", fv.Type())
+	}
+
+	return nil
+}
+
+// setSlice stores a list tag in a slice field. []byte fields receive the
+// decoded value of binary tags and a single value becomes a slice with
+// one element.
+func setSlice(fv reflect.Value, v value) error {
+	if fv.Type().Elem().Kind() == reflect.Uint8 {
+		s, ok := v.text()
+		if !ok {
+			return errors.New("not binary data")
+		}
+		b, err := decodeBytes(s)
+		if err != nil {
+			return err
+		}
+		fv.SetBytes(b)
+		return nil
+	}
+
+	var items []value
+	if v.typ == jsonparser.Array {
+		jsonparser.ArrayEach(v.data, func(data []byte, typ jsonparser.ValueType, _ int, _ error) {
+			items = append(items, value{data: data, typ: typ})
+		})
+	} else {
+		items = []value{v}
+	}
+
+	slice := reflect.MakeSlice(fv.Type(), len(items), len(items))
+	for i, item := range items {
+		if err := setField(slice.Index(i), item); err != nil {
+			return errors.Wrapf(err, "item %d", i)
+		}
+	}
+	fv.Set(slice)
+	return nil
+}
@@ -0,0 +1,134 @@
+package exiftool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type testCamera struct {
+	Make  string `exif:"EXIF:Make"`
+	Model string `exif:"EXIF:Model"`
+}
+
+type testPhoto struct {
+	testCamera
+	Camera     testCamera
+	CreateDate time.Time `exif:"EXIF:CreateDate,required"`
+	ISO        int       `exif:"ISO"`
+	Exposure   float64   `exif:"EXIF:ExposureTime"`
+	Flash      string    `exif:"Composite:Flash"`
+	Subject    []string  `exif:"XMP:Subject"`
+	Keywords   []string
+	Thumbnail  []byte  `exif:"ThumbnailImage"`
+	Rating     *int    `exif:"XMP:Rating"`
+	Lens       *string `exif:"LensModel"`
+	Region     struct {
+		Name string `exif:"Name"`
+		Area []float64
+	} `exif:"XMP:RegionInfo"`
+	Ignored string `exif:"-"`
+}
+
+var testUnmarshalJSON = []byte(`[{
+  "SourceFile": "a.jpg",
+  "EXIF:Make": "Apple",
+  "EXIF:Model": "iPhone 6s",
+  "EXIF:CreateDate": "2016:06:17 19:16:43",
+  "EXIF:ISO": 25,
+  "EXIF:ExposureTime": "1/125",
+  "Composite:Flash": "Off, Did not fire",
+  "XMP:Subject": ["cat", "garden"],
+  "IPTC:Keywords": "cat",
+  "EXIF:ThumbnailImage": "base64:aGVsbG8=",
+  "XMP:Rating": 4,
+  "XMP:RegionInfo": {"Name": "Kitty", "Area": [0.5, 0.25]},
+  "Ignored": "no"
+},{
+  "SourceFile": "b.jpg",
+  "EXIF:CreateDate": "0000:00:00 00:00:00",
+  "Composite:Flash": "No"
+}]`)
+
+func TestUnmarshal(t *testing.T) {
+	assert := assert.New(t)
+
+	var p testPhoto
+	if !assert.NoError(Unmarshal(testUnmarshalJSON, &p)) {
+		return
+	}
+
+	assert.Equal("Apple", p.Make)
+	assert.Equal("iPhone 6s", p.Camera.Model)
+	assert.Equal(time.Date(2016, 6, 17, 19, 16, 43, 0, time.UTC), p.CreateDate)
+	assert.Equal(25, p.ISO)
+	assert.Equal(0.008, p.Exposure)
+	assert.Equal("Off, Did not fire", p.Flash)
+	assert.Equal([]string{"cat", "garden"}, p.Subject)
+	assert.Equal([]string{"cat"}, p.Keywords)
+	assert.Equal([]byte("hello"), p.Thumbnail)
+	if assert.NotNil(p.Rating) {
+		assert.Equal(4, *p.Rating)
+	}
+	assert.Nil(p.Lens)
+	assert.Equal("Kitty", p.Region.Name)
+	assert.Equal([]float64{0.5, 0.25}, p.Region.Area)
+	assert.Equal("", p.Ignored)
+}
+
+func TestUnmarshalSlice(t *testing.T) {
+	assert := assert.New(t)
+
+	var dates []struct {
+		SourceFile string
+		CreateDate time.Time
+	}
+	if !assert.NoError(Unmarshal(testUnmarshalJSON, &dates)) || !assert.Len(dates, 2) {
+		return
+	}
+
+	assert.Equal("a.jpg", dates[0].SourceFile)
+	assert.Equal(2016, dates[0].CreateDate.Year())
+
+	// unset dates are left as the zero value
+	assert.Equal("b.jpg", dates[1].SourceFile)
+	assert.True(dates[1].CreateDate.IsZero())
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	var required struct {
+		Model string `exif:"Model,required"`
+	}
+	err := Unmarshal([]byte(`[{"SourceFile": "b.jpg"}]`), &required)
+	assert.Equal(ErrTagNotFound, errors.Cause(err))
+	assert.Contains(err.Error(), "Model")
+
+	var wrongType struct {
+		ISO   uint8 `exif:"ISO"`
+		Flash bool  `exif:"Flash"`
+	}
+	err = Unmarshal([]byte(`[{"ISO": 1600}]`), &wrongType)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "ISO")
+	}
+
+	// only the second file's flash is a boolean
+	var photos []*struct {
+		Flash bool `exif:"Flash"`
+	}
+	err = Unmarshal(testUnmarshalJSON, &photos)
+	if uerr, ok := err.(*UnmarshalError); assert.True(ok) {
+		assert.Equal("Flash", uerr.Tag)
+		assert.Equal("Flash", uerr.Field)
+	}
+
+	err = Unmarshal(testUnmarshalJSON, required)
+	assert.Error(err)
+
+	err = Unmarshal([]byte(`[]`), &required)
+	assert.Error(err)
+}
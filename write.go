@@ -0,0 +1,270 @@
+package exiftool
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// TagChanges describes changes to make to the metadata of one or more
+// files in a single exiftool call. Deletes are applied first, then tags
+// are copied and finally new values are set.
+type TagChanges struct {
+	// Set assigns a value to each tag, such as `Artist` or `XMP:Title`
+	Set map[string]string
+
+	// Delete removes tags or whole groups, such as `Comment` or `GPS:all`
+	Delete []string
+
+	// CopyFrom is a file to copy tags from with -tagsFromFile
+	CopyFrom string
+
+	// CopyTags limits which tags are copied from CopyFrom. All writable
+	// tags are copied when it is empty.
+	CopyTags []string
+
+	// Backup keeps the original file renamed with an _original suffix.
+	// Without it files are changed with -overwrite_original.
+	Backup bool
+
+	// PreserveModTime keeps the file modification date and time (-P)
+	PreserveModTime bool
+}
+
+// args turns the changes into exiftool arguments
+func (c TagChanges) args() ([]string, error) {
+	var args []string
+
+	if !c.Backup {
+		args = append(args, "-overwrite_original")
+	}
+
+	if c.PreserveModTime {
+		args = append(args, "-P")
+	}
+
+	for _, tag := range c.Delete {
+		if err := validateTagName(tag); err != nil {
+			return nil, err
+		}
+		args = append(args, "-"+tag+"=")
+	}
+
+	if c.CopyFrom != "" {
+		from, err := SafePath(c.CopyFrom)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "-tagsFromFile", from)
+		for _, tag := range c.CopyTags {
+			if err := validateTagName(tag); err != nil {
+				return nil, err
+			}
+			args = append(args, "-"+tag)
+		}
+	}
+
+	// sorted so the same changes always produce the same arguments
+	tags := make([]string, 0, len(c.Set))
+	for tag := range c.Set {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	for _, tag := range tags {
+		if err := validateTagName(tag); err != nil {
+			return nil, err
+		}
+		args = append(args, "-"+tag+"="+c.Set[tag])
+	}
+
+	if len(c.Delete) == 0 && len(c.Set) == 0 && c.CopyFrom == "" {
+		return nil, errors.New("No changes")
+	}
+
+	return args, nil
+}
+
+func validateTagName(tag string) error {
+	if tag == "" || strings.HasPrefix(tag, "-") || strings.ContainsAny(tag, "=<>\r\n\t ") {
+		return errors.Errorf("Invalid tag name %q", tag)
+	}
+	return nil
+}
+
+// WriteResult holds the counts exiftool prints after writing, such as
+// "1 image files updated", and what happened to each file
+type WriteResult struct {
+	Updated   int
+	Unchanged int
+	Created   int
+	Failed    int
+
+	Files []FileResult
+
+	// Warnings that were not about a specific file
+	Warnings []Warning
+}
+
+// FileResult is the outcome of writing to a single file
+type FileResult struct {
+	Filename string
+
+	// Err is the *Error exiftool reported for the file or nil if it was
+	// written successfully
+	Err error
+
+	Warnings []Warning
+}
+
+var writeSummaryRegexp = regexp.MustCompile(`^(\d+) (?:image )?files? (.+)$`)
+
+// parseWriteResult reads the summary exiftool printed to stdout and matches
+// the messages on stderr to the files they are about
+func parseWriteResult(stdout, stderr []byte, filenames []string) (*WriteResult, error) {
+	result := &WriteResult{Files: make([]FileResult, len(filenames))}
+	for i, f := range filenames {
+		result.Files[i].Filename = f
+	}
+
+	summary := false
+	scanner := bufio.NewScanner(bytes.NewReader(stdout))
+	for scanner.Scan() {
+		match := writeSummaryRegexp.FindStringSubmatch(strings.TrimSpace(scanner.Text()))
+		if match == nil {
+			continue
+		}
+
+		n, _ := strconv.Atoi(match[1])
+		switch {
+		case strings.HasPrefix(match[2], "updated"):
+			result.Updated += n
+		case strings.HasPrefix(match[2], "unchanged"):
+			result.Unchanged += n
+		case strings.HasPrefix(match[2], "created"), strings.HasPrefix(match[2], "copied"):
+			result.Created += n
+		case strings.Contains(match[2], "due to errors"):
+			result.Failed += n
+		default:
+			continue
+		}
+		summary = true
+	}
+
+	var general error
+	scanner = bufio.NewScanner(bytes.NewReader(stderr))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		warnings, err := parseStderr([]byte(line))
+
+		var file *FileResult
+		if i := messageFile(filenames, line); i != -1 {
+			file = &result.Files[i]
+		}
+
+		switch {
+		case file != nil && err != nil:
+			if file.Err == nil {
+				file.Err = err
+			}
+		case file != nil:
+			file.Warnings = append(file.Warnings, warnings...)
+		case err != nil:
+			if general == nil {
+				general = err
+			}
+		default:
+			result.Warnings = append(result.Warnings, warnings...)
+		}
+	}
+
+	if !summary {
+		if general != nil {
+			return nil, general
+		}
+		return nil, errors.New("No write summary in exiftool output")
+	}
+
+	return result, nil
+}
+
+// messageFile returns the index of the file an exiftool message like
+// `Error: File not found - a.jpg` is about or -1 if it isn't about one
+func messageFile(filenames []string, line string) int {
+	for i, f := range filenames {
+		if strings.HasSuffix(line, " - "+f) || strings.HasSuffix(line, " - ./"+f) {
+			return i
+		}
+	}
+	return -1
+}
+
+// WriteTags applies the changes to the files
+func WriteTags(ctx context.Context, exiftool string, changes TagChanges, filenames ...string) (*WriteResult, error) {
+	args, err := writeArgs(changes, filenames)
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, stderr, err := runOutput(ctx, exiftool, nil, args)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	// exiftool exits with an error when any file fails, which the result
+	// reports per file
+	if _, exited := err.(*exec.ExitError); err != nil && !exited {
+		return nil, errors.Wrap(err, "Failed running exiftool")
+	}
+
+	return parseWriteResult(stdout, stderr, filenames)
+}
+
+// WriteTags applies the changes to the files
+func (e *Stayopen) WriteTags(ctx context.Context, changes TagChanges, filenames ...string) (*WriteResult, error) {
+	args, err := writeArgs(changes, filenames)
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, stderr, err := e.do(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	return parseWriteResult(stdout, stderr, filenames)
+}
+
+// WriteTags applies the changes to the files
+func (p *Pool) WriteTags(ctx context.Context, changes TagChanges, filenames ...string) (*WriteResult, error) {
+	s, done, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return s.WriteTags(ctx, changes, filenames...)
+}
+
+func writeArgs(changes TagChanges, filenames []string) ([]string, error) {
+	if len(filenames) == 0 {
+		return nil, errors.New("No files to write")
+	}
+
+	args, err := changes.args()
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := fileArgs(filenames...)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(args, files...), nil
+}
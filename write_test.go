@@ -0,0 +1,158 @@
+package exiftool
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagChangesArgs(t *testing.T) {
+	assert := assert.New(t)
+
+	args, err := TagChanges{
+		Set:             map[string]string{"XMP:Title": "Cat", "Artist": "Jane Doe"},
+		Delete:          []string{"GPS:all"},
+		CopyFrom:        "src.jpg",
+		CopyTags:        []string{"ICC_Profile"},
+		PreserveModTime: true,
+	}.args()
+
+	assert.NoError(err)
+	assert.Equal([]string{
+		"-overwrite_original",
+		"-P",
+		"-GPS:all=",
+		"-tagsFromFile", "src.jpg", "-ICC_Profile",
+		"-Artist=Jane Doe",
+		"-XMP:Title=Cat",
+	}, args)
+
+	args, err = TagChanges{Delete: []string{"Comment"}, Backup: true}.args()
+	assert.NoError(err)
+	assert.Equal([]string{"-Comment="}, args)
+
+	_, err = TagChanges{}.args()
+	assert.Error(err)
+
+	_, err = TagChanges{Delete: []string{"-o"}}.args()
+	assert.Error(err)
+
+	// line breaks are encoded by Stayopen and passed as they are otherwise
+	args, err = TagChanges{Set: map[string]string{"Comment": "two\nlines"}}.args()
+	assert.NoError(err)
+	assert.Equal([]string{"-overwrite_original", "-Comment=two\nlines"}, args)
+}
+
+func TestParseWriteResult(t *testing.T) {
+	assert := assert.New(t)
+
+	stdout := []byte("    1 image files updated\n    1 image files unchanged\n    1 files weren't updated due to errors\n")
+	stderr := []byte("Warning: [minor] Ignored empty rational value - a.jpg\n" +
+		"Error: File not found - c.jpg\n" +
+		"Warning: Some general warning\n")
+
+	result, err := parseWriteResult(stdout, stderr, []string{"a.jpg", "b.jpg", "c.jpg"})
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.Equal(1, result.Updated)
+	assert.Equal(1, result.Unchanged)
+	assert.Equal(1, result.Failed)
+
+	assert.NoError(result.Files[0].Err)
+	assert.Len(result.Files[0].Warnings, 1)
+	assert.NoError(result.Files[1].Err)
+	assert.Equal(ErrFileNotFound, errors.Cause(result.Files[2].Err))
+	assert.Equal([]Warning{{Message: "Some general warning"}}, result.Warnings)
+
+	_, err = parseWriteResult(nil, []byte("Error: Can't write\n"), []string{"a.jpg"})
+	assert.Error(err)
+}
+
+// copyTestImage copies a testdata image into a temporary directory
+func copyTestImage(t *testing.T, name string) (string, func()) {
+	dir, err := ioutil.TempDir("", "go-exiftool")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(dst, data, 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return dst, func() { os.RemoveAll(dir) }
+}
+
+func TestWriteTags(t *testing.T) {
+	assert := assert.New(t)
+
+	filename, cleanup := copyTestImage(t, "IMG_7238.JPG")
+	defer cleanup()
+
+	ctx := context.Background()
+	result, err := WriteTags(ctx, "exiftool", TagChanges{
+		Set: map[string]string{"Artist": "Jane Doe"},
+	}, filename)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(1, result.Updated)
+	assert.NoError(result.Files[0].Err)
+
+	meta, err := ExtractMetadata(ctx, "exiftool", filename, "-Artist")
+	if assert.NoError(err) {
+		artist, err := meta.GetString("Artist")
+		assert.NoError(err)
+		assert.Equal("Jane Doe", artist)
+	}
+
+	result, err = WriteTags(ctx, "exiftool", TagChanges{Delete: []string{"Artist"}}, filename, filename+".missing")
+	if assert.NoError(err) {
+		assert.Equal(1, result.Updated)
+		assert.Equal(1, result.Failed)
+		assert.Equal(ErrFileNotFound, errors.Cause(result.Files[1].Err))
+	}
+}
+
+func TestStayOpenWriteTags(t *testing.T) {
+	assert := assert.New(t)
+
+	filename, cleanup := copyTestImage(t, "IMG_7238-nogeo.jpg")
+	defer cleanup()
+
+	stayopen, err := NewStayOpen("exiftool")
+	if !assert.NoError(err) {
+		return
+	}
+	defer stayopen.Stop()
+
+	ctx := context.Background()
+	result, err := stayopen.WriteTags(ctx, TagChanges{
+		CopyFrom: "testdata/IMG_7238-geo.jpg",
+		CopyTags: []string{"GPSLatitude", "GPSLatitudeRef", "GPSLongitude", "GPSLongitudeRef"},
+	}, filename)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(1, result.Updated)
+
+	meta, err := stayopen.ExtractMetadata(ctx, filename)
+	if assert.NoError(err) {
+		_, err := meta.Location()
+		assert.NoError(err)
+	}
+}